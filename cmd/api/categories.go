@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+func (a *appDependencies) createCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		ParentID *int64 `json:"parent_id"`
+		Name     string `json:"name"`
+		Slug     string `json:"slug"`
+		Position int32  `json:"position"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Slug == "" {
+		incomingData.Slug = data.Slugify(incomingData.Name)
+	}
+
+	category := &data.Category{
+		ParentID: incomingData.ParentID,
+		Name:     incomingData.Name,
+		Slug:     incomingData.Slug,
+		Position: incomingData.Position,
+	}
+
+	v := validator.New()
+	data.ValidateCategory(v, category)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.categoryModel.Insert(category)
+	if err != nil {
+		a.categoryErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/categories/%d", category.ID))
+
+	data := envelope{
+		"category": category,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	category, err := a.categoryModel.Get(id)
+	if err != nil {
+		a.categoryErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"category": category,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	category, err := a.categoryModel.Get(id)
+	if err != nil {
+		a.categoryErrResponse(w, r, err)
+		return
+	}
+
+	var incomingData struct {
+		ParentID *int64  `json:"parent_id"`
+		Name     *string `json:"name"`
+		Slug     *string `json:"slug"`
+		Position *int32  `json:"position"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// A parent_id of 0 moves the category back to the root.
+	if incomingData.ParentID != nil {
+		category.ParentID = incomingData.ParentID
+		if *incomingData.ParentID == 0 {
+			category.ParentID = nil
+		}
+	}
+	if incomingData.Name != nil {
+		category.Name = *incomingData.Name
+	}
+	if incomingData.Slug != nil {
+		category.Slug = *incomingData.Slug
+	}
+	if incomingData.Position != nil {
+		category.Position = *incomingData.Position
+	}
+
+	v := validator.New()
+	data.ValidateCategory(v, category)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.categoryModel.Update(category)
+	if err != nil {
+		a.categoryErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"category": category,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.categoryModel.Delete(id)
+	if err != nil {
+		a.categoryErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "category successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := a.categoryModel.GetAll()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"categories": categories,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) categoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	tree, err := a.categoryModel.Tree()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"categories": tree,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) categoryErrResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateSlug):
+		a.conflictResponse(w, r, "a category with this slug already exists")
+	case errors.Is(err, data.ErrUnknownCategory):
+		a.failedValidationResponse(w, r, map[string]string{"parent_id": "must be an existing category"})
+	case errors.Is(err, data.ErrCategoryCycle):
+		a.failedValidationResponse(w, r, map[string]string{"parent_id": "must not be the category itself or one of its descendants"})
+	case errors.Is(err, data.ErrCategoryInUse):
+		a.conflictResponse(w, r, "the category still has products or subcategories")
+	default:
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -46,7 +46,48 @@ func (a *appDependencies) failedValidationResponse(w http.ResponseWriter, r *htt
 	a.errResponseJSON(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+func (a *appDependencies) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you do not have the necessary permissions to access this resource"
+	a.errResponseJSON(w, r, http.StatusForbidden, message)
+}
+
+func (a *appDependencies) conflictResponse(w http.ResponseWriter, r *http.Request, message string) {
+	a.errResponseJSON(w, r, http.StatusConflict, message)
+}
+
+func (a *appDependencies) stockHeldResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the stock must be at least what pending reservations hold"
+	a.conflictResponse(w, r, message)
+}
+
+func (a *appDependencies) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource is only available as application/json, application/x-ndjson or text/csv"
+	a.errResponseJSON(w, r, http.StatusNotAcceptable, message)
+}
+
+func (a *appDependencies) shuttingDownResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the server is shutting down, please try again later"
+	a.errResponseJSON(w, r, http.StatusServiceUnavailable, message)
+}
+
 func (a *appDependencies) rateLimitExceedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	a.errResponseJSON(w, r, http.StatusTooManyRequests, message)
 }
+
+func (a *appDependencies) duplicateReviewResponse(w http.ResponseWriter, r *http.Request, reviewID int64) {
+	location := fmt.Sprintf("/v1/review/%d", reviewID)
+
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	errData := envelope{
+		"error":           "this author has already reviewed this product",
+		"existing_review": location,
+	}
+	err := a.writeJSON(w, http.StatusConflict, errData, headers)
+	if err != nil {
+		a.logError(r, err)
+		w.WriteHeader(500)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// importExchangeRatesHandler replaces exchange rates from either a JSON body
+// of the form {"rates": [...]} or a text/csv body with from,to,rate rows.
+func (a *appDependencies) importExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	var rates []*data.ExchangeRate
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		var err error
+		rates, err = a.readExchangeRatesCSV(w, r)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+	} else {
+		var incomingData struct {
+			Rates []*data.ExchangeRate `json:"rates"`
+		}
+
+		err := a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+		rates = incomingData.Rates
+	}
+
+	v := validator.New()
+	v.Check(len(rates) > 0, "rates", "must contain at least one rate")
+	v.Check(len(rates) <= 1000, "rates", "must not contain more than 1000 rates")
+	for i, rate := range rates {
+		rate.From = strings.ToUpper(strings.TrimSpace(rate.From))
+		rate.To = strings.ToUpper(strings.TrimSpace(rate.To))
+		rate.Rate = strings.TrimSpace(rate.Rate)
+		data.ValidateExchangeRate(v, rate, i)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := a.exchangeRateModel.Upsert(rates)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"rates": rates,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// readExchangeRatesCSV reads from,to,rate rows. A first row whose first
+// column is "from" is treated as a header and skipped.
+func (a *appDependencies) readExchangeRatesCSV(w http.ResponseWriter, r *http.Request) ([]*data.ExchangeRate, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 256_000)
+
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	rates := []*data.ExchangeRate{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit)
+			}
+			return nil, fmt.Errorf("the body contains badly-formed CSV: %w", err)
+		}
+
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "from") {
+			continue
+		}
+
+		rates = append(rates, &data.ExchangeRate{From: record[0], To: record[1], Rate: record[2]})
+	}
+
+	return rates, nil
+}
+
+func (a *appDependencies) listExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := a.exchangeRateModel.GetAll()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"rates": rates,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// requestedCurrency returns the currency a client wants prices shown in,
+// from the currency query parameter or else the first entry of the
+// Accept-Currency header. It returns "" when neither is given.
+func (a *appDependencies) requestedCurrency(r *http.Request, v *validator.Validator) string {
+	currency := r.URL.Query().Get("currency")
+	if currency == "" {
+		currency, _, _ = strings.Cut(r.Header.Get("Accept-Currency"), ",")
+		currency, _, _ = strings.Cut(currency, ";")
+	}
+
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return ""
+	}
+
+	v.Check(data.ValidCurrency(currency), "currency", "must be a supported ISO 4217 code")
+
+	return currency
+}
+
+// convertPrices fills in the converted price of each product, and of each
+// variant price override, using the configured rounding. It fails with
+// ErrNoExchangeRate if any product is priced in a currency that has no rate
+// to the requested one.
+func (a *appDependencies) convertPrices(products []*data.Product, currency string) error {
+	var from []string
+	for _, product := range products {
+		if product.Price.Currency != currency {
+			from = append(from, product.Price.Currency)
+		}
+	}
+
+	rates, err := a.exchangeRateModel.Lookup(currency, from)
+	if err != nil {
+		return err
+	}
+
+	rounding := data.Rounding(a.config.currency.rounding)
+	for _, product := range products {
+		// Overrides are always in the product's currency, so they convert
+		// at the product's rate.
+		product.ConvertedPrice, err = convertPrice(product.Price, currency, rates, rounding)
+		if err != nil {
+			return err
+		}
+
+		for _, variant := range product.Variants {
+			if variant.PriceOverride == nil {
+				continue
+			}
+
+			variant.ConvertedPriceOverride, err = convertPrice(*variant.PriceOverride, currency, rates, rounding)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func convertPrice(price data.Money, currency string, rates map[string]*data.ExchangeRate, rounding data.Rounding) (*data.ConvertedPrice, error) {
+	if price.Currency == currency {
+		return &data.ConvertedPrice{Price: price, Rate: "1"}, nil
+	}
+
+	rate, ok := rates[price.Currency]
+	if !ok {
+		return nil, fmt.Errorf("%w from %s to %s", data.ErrNoExchangeRate, price.Currency, currency)
+	}
+
+	converted, err := price.Convert(rate, rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.ConvertedPrice{
+		Price:         converted,
+		Rate:          rate.Rate,
+		RateUpdatedAt: &rate.UpdatedAt,
+	}, nil
+}
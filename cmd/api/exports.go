@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+const (
+	// exportFlushEvery is how many records an export writes between flushes,
+	// so that clients receive it as it is produced.
+	exportFlushEvery = 500
+
+	// exportWriteTimeout replaces the server's write timeout for exports,
+	// which write every matching row.
+	exportWriteTimeout = 30 * time.Minute
+)
+
+// exportFormats maps the media types an export can be requested in to the
+// file extension of each.
+var exportFormats = map[string]string{
+	"application/x-ndjson": "ndjson",
+	"application/ndjson":   "ndjson",
+	"text/csv":             "csv",
+	"application/json":     "json",
+}
+
+// exportMediaType picks the first media type in the Accept header that an
+// export can be written in. A missing header or a wildcard means a JSON
+// array. It returns "" when none is acceptable.
+func exportMediaType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return "application/json"
+	}
+
+	for _, option := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(option))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+
+		if mediaType == "*/*" || mediaType == "application/*" {
+			return "application/json"
+		}
+		if _, ok := exportFormats[mediaType]; ok {
+			return mediaType
+		}
+	}
+
+	return ""
+}
+
+// exportEncoder writes the records of an export as NDJSON, CSV or a JSON
+// array. Nothing is sent until the first record, or until close for an empty
+// export, so an export that fails before then can still get an error
+// response; one that fails after then is cut short.
+type exportEncoder struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	mediaType  string
+	filename   string
+	csvHeader  []string
+	csv        *csv.Writer
+	started    bool
+	count      int
+}
+
+func newExportEncoder(w http.ResponseWriter, mediaType string, name string, csvHeader []string) *exportEncoder {
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	return &exportEncoder{
+		w:          w,
+		controller: controller,
+		mediaType:  mediaType,
+		filename:   name + "." + exportFormats[mediaType],
+		csvHeader:  csvHeader,
+	}
+}
+
+func (e *exportEncoder) start() error {
+	e.started = true
+
+	e.w.Header().Set("Content-Type", e.mediaType)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.filename))
+	e.w.Header().Set("Vary", "Accept")
+	e.w.WriteHeader(http.StatusOK)
+
+	switch exportFormats[e.mediaType] {
+	case "csv":
+		e.csv = csv.NewWriter(e.w)
+		return e.csv.Write(e.csvHeader)
+	case "json":
+		_, err := e.w.Write([]byte("["))
+		return err
+	}
+	return nil
+}
+
+// write adds one record. csvRecord gives its CSV row, matching csvHeader, and
+// is only called for CSV exports.
+func (e *exportEncoder) write(record any, csvRecord func() []string) error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch exportFormats[e.mediaType] {
+	case "csv":
+		err = e.csv.Write(csvRecord())
+	case "json":
+		err = e.writeJSONRecord(record, ",\n")
+	default:
+		err = e.writeJSONRecord(record, "\n")
+	}
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%exportFlushEvery == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// writeJSONRecord writes record, preceded by separator unless it is the first
+// one of a JSON array.
+func (e *exportEncoder) writeJSONRecord(record any, separator string) error {
+	js, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if exportFormats[e.mediaType] == "json" {
+		if e.count > 0 {
+			js = append([]byte(separator), js...)
+		}
+	} else {
+		js = append(js, separator...)
+	}
+
+	_, err = e.w.Write(js)
+	return err
+}
+
+func (e *exportEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		err := e.csv.Error()
+		if err != nil {
+			return err
+		}
+	}
+	return e.controller.Flush()
+}
+
+// close finishes the export, writing the CSV header or an empty JSON array
+// if there were no records.
+func (e *exportEncoder) close() error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if exportFormats[e.mediaType] == "json" {
+		_, err := e.w.Write([]byte("]\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.flush()
+}
+
+// exportFailed reports an error from an export, as an error response if
+// nothing has been sent yet.
+func (a *appDependencies) exportFailed(w http.ResponseWriter, r *http.Request, encoder *exportEncoder, err error) {
+	if !encoder.started {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	a.logError(r, err)
+}
+
+var productExportColumns = []string{"id", "external_sku", "name", "description", "category", "price", "currency", "average_rating", "image_url", "seller", "stock", "tags", "created_at"}
+
+// exportProductsHandler streams every product matching the list filters, in
+// ID order and without paging, in the format asked for by the Accept header.
+func (a *appDependencies) exportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType := exportMediaType(r)
+	if mediaType == "" {
+		a.notAcceptableResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filter := a.readProductFilter(r.URL.Query(), v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	encoder := newExportEncoder(w, mediaType, "products", productExportColumns)
+
+	err := a.productModel.Export(r.Context(), filter, func(product *data.Product) error {
+		return encoder.write(product, func() []string {
+			return []string{
+				strconv.FormatInt(product.ID, 10),
+				product.ExternalSKU,
+				product.Name,
+				product.Description,
+				product.Category,
+				product.Price.Decimal(),
+				product.Price.Currency,
+				strconv.FormatFloat(product.AverageRating, 'f', -1, 64),
+				product.ImageURL,
+				product.Seller,
+				strconv.FormatInt(int64(product.Stock), 10),
+				strings.Join(product.Tags, "|"),
+				product.CreatedAt.Format(time.RFC3339),
+			}
+		})
+	})
+	if err == nil {
+		err = encoder.close()
+	}
+	if err != nil {
+		a.exportFailed(w, r, encoder, err)
+	}
+}
+
+var reviewExportColumns = []string{"id", "product_id", "variant_id", "author", "rating", "text", "helpful_count", "unhelpful_count", "verified_purchase", "created_at", "updated_at", "edited_at"}
+
+// exportReviewsHandler streams every review matching the list filters the
+// same way exportProductsHandler does for products.
+func (a *appDependencies) exportReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	mediaType := exportMediaType(r)
+	if mediaType == "" {
+		a.notAcceptableResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	filter := a.readReviewFilter(r.URL.Query(), v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	encoder := newExportEncoder(w, mediaType, "reviews", reviewExportColumns)
+
+	err := a.reviewModel.Export(r.Context(), filter, func(review *data.Review) error {
+		return encoder.write(review, func() []string {
+			variantID := ""
+			if review.VariantID != nil {
+				variantID = strconv.FormatInt(*review.VariantID, 10)
+			}
+			editedAt := ""
+			if review.EditedAt != nil {
+				editedAt = review.EditedAt.Format(time.RFC3339)
+			}
+
+			return []string{
+				strconv.FormatInt(review.ID, 10),
+				strconv.FormatInt(review.ProductID, 10),
+				variantID,
+				review.Author,
+				strconv.FormatInt(review.Rating, 10),
+				review.Text,
+				strconv.FormatInt(int64(review.HelpfulCount), 10),
+				strconv.FormatInt(int64(review.UnhelpfulCount), 10),
+				strconv.FormatBool(review.Verified),
+				review.CreatedAt.Format(time.RFC3339),
+				review.UpdatedAt.Format(time.RFC3339),
+				editedAt,
+			}
+		})
+	})
+	if err == nil {
+		err = encoder.close()
+	}
+	if err != nil {
+		a.exportFailed(w, r, encoder, err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"text/csv", "text/csv"},
+		{"application/ndjson", "application/ndjson"},
+		{"text/html, application/x-ndjson;q=0.9", "application/x-ndjson"},
+		{"text/csv;q=0, application/json", "application/json"},
+		{"text/html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/products/export", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			if got := exportMediaType(r); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type exportTestRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// encodeExport writes records through an exportEncoder and returns what the
+// client received.
+func encodeExport(t *testing.T, mediaType string, records []exportTestRecord) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	encoder := newExportEncoder(w, mediaType, "things", []string{"id", "name"})
+
+	for _, record := range records {
+		err := encoder.write(record, func() []string {
+			return []string{string(rune('0' + record.ID)), record.Name}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := encoder.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestExportEncoder(t *testing.T) {
+	records := []exportTestRecord{{1, "Kettle"}, {2, `Toaster, "2-slice"`}}
+
+	tests := []struct {
+		name      string
+		mediaType string
+		records   []exportTestRecord
+		want      string
+	}{
+		{"ndjson", "application/x-ndjson", records, "{\"id\":1,\"name\":\"Kettle\"}\n{\"id\":2,\"name\":\"Toaster, \\\"2-slice\\\"\"}\n"},
+		{"empty ndjson", "application/x-ndjson", nil, ""},
+		{"json", "application/json", records, "[{\"id\":1,\"name\":\"Kettle\"},\n{\"id\":2,\"name\":\"Toaster, \\\"2-slice\\\"\"}]\n"},
+		{"empty json", "application/json", nil, "[]\n"},
+		{"csv", "text/csv", records, "id,name\n1,Kettle\n2,\"Toaster, \"\"2-slice\"\"\"\n"},
+		{"empty csv", "text/csv", nil, "id,name\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := encodeExport(t, tt.mediaType, tt.records)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("got status %d; want %d", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.mediaType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.mediaType)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("got body %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportEncoderFilename(t *testing.T) {
+	w := encodeExport(t, "application/ndjson", nil)
+
+	want := `attachment; filename="things.ndjson"`
+	if got := w.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("got Content-Disposition %q; want %q", got, want)
+	}
+}
+
+func TestExportJSONIsValid(t *testing.T) {
+	records := make([]exportTestRecord, exportFlushEvery+1)
+	for i := range records {
+		records[i] = exportTestRecord{ID: i % 10, Name: "Kettle"}
+	}
+
+	w := encodeExport(t, "application/json", records)
+
+	var decoded []exportTestRecord
+	err := json.Unmarshal(w.Body.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("got invalid JSON across a flush: %v", err)
+	}
+	if len(decoded) != len(records) {
+		t.Errorf("got %d records; want %d", len(decoded), len(records))
+	}
+}
+
+func TestExportFailed(t *testing.T) {
+	a := &appDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	r := httptest.NewRequest(http.MethodGet, "/v1/products/export", nil)
+
+	w := httptest.NewRecorder()
+	encoder := newExportEncoder(w, "text/csv", "things", []string{"id"})
+	a.exportFailed(w, r, encoder, errors.New("query failed"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d for a failure before the first record; want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	w = httptest.NewRecorder()
+	encoder = newExportEncoder(w, "text/csv", "things", []string{"id"})
+	err := encoder.write(nil, func() []string { return []string{"1"} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.exportFailed(w, r, encoder, errors.New("query failed"))
+
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "error") {
+		t.Errorf("got status %d and body %q after the export started; want it cut short, not replaced", w.Code, w.Body.String())
+	}
+}
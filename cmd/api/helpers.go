@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/thats-insane/awt-test1/internal/validator"
@@ -108,6 +109,27 @@ func (a *appDependencies) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+func (a *appDependencies) readInt64Param(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	value, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return value, nil
+}
+
+// readBearerToken returns the token in an "Authorization: Bearer" header, or
+// "" when there is none.
+func (a *appDependencies) readBearerToken(r *http.Request) string {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
 func (a *appDependencies) getSingleQueryParam(queryParams url.Values, key string, defaultVal string) string {
 	result := queryParams.Get(key)
 
@@ -131,3 +153,34 @@ func (a *appDependencies) getSingleIntParam(queryParams url.Values, key string,
 
 	return intVal
 }
+
+func (a *appDependencies) getOptionalBoolParam(queryParams url.Values, key string, v *validator.Validator) *bool {
+	result := queryParams.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	boolVal, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &boolVal
+}
+
+// getOptionalDateParam parses a YYYY-MM-DD query parameter as midnight UTC.
+func (a *appDependencies) getOptionalDateParam(queryParams url.Values, key string, v *validator.Validator) *time.Time {
+	result := queryParams.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	date, err := time.Parse(time.DateOnly, result)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+
+	return &date
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// startJobs launches the periodic background jobs. They stop when ctx is
+// cancelled and serve waits for them before returning.
+func (a *appDependencies) startJobs(ctx context.Context) {
+	a.runPeriodically(ctx, "expire reservations", a.config.reservations.sweepInterval, func() error {
+		expired, err := a.reservationModel.ExpireDue()
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			a.logger.Info("expired reservations", "count", expired)
+		}
+		return nil
+	})
+
+	a.runPeriodically(ctx, "purge trash", a.config.trash.purgeInterval, a.purgeTrash)
+
+	// Recommendations and rankings are only stored by their jobs, so those
+	// also run at startup rather than leaving them empty until the first tick.
+	a.runInBackground("recompute similar products", a.recomputeSimilarProducts)
+	a.runPeriodically(ctx, "recompute similar products", a.config.similarProducts.interval, a.recomputeSimilarProducts)
+
+	recomputeRankings := func() error {
+		_, err := a.rankingModel.Recompute()
+		return err
+	}
+	a.runInBackground("recompute rankings", recomputeRankings)
+	a.runPeriodically(ctx, "recompute rankings", a.config.rankings.interval, recomputeRankings)
+}
+
+func (a *appDependencies) recomputeSimilarProducts() error {
+	stored, err := a.similarProductModel.Recompute()
+	if err != nil {
+		return err
+	}
+	a.logger.Info("recomputed similar products", "count", stored)
+	return nil
+}
+
+// purgeTrash permanently removes products and reviews that have been deleted
+// for longer than the retention period, then removes orphaned stored images.
+func (a *appDependencies) purgeTrash() error {
+	reviews, err := a.reviewModel.Purge(a.config.trash.retention)
+	if err != nil {
+		return err
+	}
+
+	products, err := a.productModel.Purge(a.config.trash.retention)
+	if err != nil {
+		return err
+	}
+
+	if reviews > 0 || products > 0 {
+		a.logger.Info("purged trash", "products", products, "reviews", reviews)
+	}
+
+	return a.removeOrphanedObjects()
+}
+
+// removeOrphanedObjects deletes the stored objects of deleted review photos
+// and product images. Keys whose object could not be deleted stay queued and
+// are retried on the next run.
+func (a *appDependencies) removeOrphanedObjects() error {
+	const batchSize = 500
+
+	for {
+		keys, err := a.orphanedObjectModel.Pending(batchSize)
+		if err != nil {
+			return err
+		}
+
+		removed := []string{}
+		for _, key := range keys {
+			err := a.storage.Delete(context.Background(), key)
+			if err != nil {
+				a.logger.Error(err.Error(), "key", key)
+				continue
+			}
+			removed = append(removed, key)
+		}
+
+		err = a.orphanedObjectModel.Forget(removed)
+		if err != nil {
+			return err
+		}
+
+		if len(keys) < batchSize || len(removed) == 0 {
+			return nil
+		}
+	}
+}
+
+// runPeriodically calls job every interval until ctx is cancelled. A failing
+// or panicking run is logged and does not stop the next one.
+func (a *appDependencies) runPeriodically(ctx context.Context, name string, interval time.Duration, job func() error) {
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.runJob(name, job)
+			}
+		}
+	}()
+}
+
+// runInBackground runs job once in its own goroutine. Like the periodic jobs,
+// serve waits for it to finish before returning, so a long job should watch
+// a.jobsCtx and stop early once it is cancelled. Once stopJobs has been
+// called the job is not started and runInBackground reports false.
+func (a *appDependencies) runInBackground(name string, job func() error) bool {
+	a.jobsMu.Lock()
+	defer a.jobsMu.Unlock()
+
+	if a.jobsStopped {
+		return false
+	}
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+		a.runJob(name, job)
+	}()
+
+	return true
+}
+
+// stopJobs refuses any further background jobs, cancels the running ones
+// through cancel and waits for them to return. Taking jobsMu first means no
+// request handler can add to wg while it is being waited on.
+func (a *appDependencies) stopJobs(cancel context.CancelFunc) {
+	a.jobsMu.Lock()
+	a.jobsStopped = true
+	a.jobsMu.Unlock()
+
+	cancel()
+	a.wg.Wait()
+}
+
+func (a *appDependencies) runJob(name string, job func() error) {
+	defer func() {
+		if err := recover(); err != nil {
+			a.logger.Error(fmt.Sprintf("%v", err), "job", name)
+		}
+	}()
+
+	err := job()
+	if err != nil {
+		a.logger.Error(err.Error(), "job", name)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunInBackgroundAfterStop(t *testing.T) {
+	a := &appDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	var runs atomic.Int32
+	job := func() error {
+		runs.Add(1)
+		return nil
+	}
+
+	if !a.runInBackground("before", job) {
+		t.Error("got a job refused before shutdown")
+	}
+
+	_, cancel := context.WithCancel(context.Background())
+	a.stopJobs(cancel)
+
+	if runs.Load() != 1 {
+		t.Errorf("got %d runs once stopJobs returned; want the started job waited for", runs.Load())
+	}
+
+	if a.runInBackground("after", job) {
+		t.Error("got a job started after shutdown began")
+	}
+	if runs.Load() != 1 {
+		t.Errorf("got %d runs; want the refused job never run", runs.Load())
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/storage"
 )
 
 const appVersion = "1.0.0"
@@ -25,13 +27,77 @@ type serverConfig struct {
 		burst   int
 		enabled bool
 	}
+	storage struct {
+		backend   string
+		dir       string
+		endpoint  string
+		region    string
+		bucket    string
+		accessKey string
+		secretKey string
+	}
+	media struct {
+		maxBytes      int64
+		maxDimension  int
+		thumbnailSize int
+	}
+	currency struct {
+		rounding string
+	}
+	search struct {
+		language string
+	}
+	reservations struct {
+		ttl           time.Duration
+		sweepInterval time.Duration
+	}
+	similarProducts struct {
+		interval time.Duration
+	}
+	rankings struct {
+		interval time.Duration
+	}
+	imports struct {
+		maxBytes int64
+	}
+	orders struct {
+		checkoutToken string
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
 }
 
 type appDependencies struct {
-	config       serverConfig
-	logger       *slog.Logger
-	productModel data.ProductModel
-	reviewModel  data.ReviewModel
+	config              serverConfig
+	logger              *slog.Logger
+	wg                  sync.WaitGroup
+	jobsMu              sync.Mutex
+	jobsStopped         bool
+	jobsCtx             context.Context
+	storage             storage.Storage
+	productModel        data.ProductModel
+	reviewModel         data.ReviewModel
+	reviewStatsModel    data.ReviewStatsModel
+	reviewResponseModel data.ReviewResponseModel
+	reviewRevisionModel data.ReviewRevisionModel
+	ratingAspectModel   data.RatingAspectModel
+	orderModel          data.OrderModel
+	reviewMediaModel    data.ReviewMediaModel
+	questionModel       data.QuestionModel
+	answerModel         data.AnswerModel
+	categoryModel       data.CategoryModel
+	exchangeRateModel   data.ExchangeRateModel
+	priceHistoryModel   data.PriceHistoryModel
+	productVariantModel data.ProductVariantModel
+	reservationModel    data.ReservationModel
+	productImageModel   data.ProductImageModel
+	searchModel         data.SearchModel
+	similarProductModel data.SimilarProductModel
+	rankingModel        data.RankingModel
+	productImportModel  data.ProductImportModel
+	orphanedObjectModel data.OrphanedObjectModel
 }
 
 func openDB(settings serverConfig) (*sql.DB, error) {
@@ -62,10 +128,43 @@ func main() {
 	flag.Float64Var(&settings.limiter.rps, "limiter-rps", 2, "Rate Limiter maximum requests per second")
 	flag.IntVar(&settings.limiter.burst, "limiter-burst", 5, "Rate Limiter maximum burst")
 	flag.BoolVar(&settings.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&settings.storage.backend, "storage", "local", "Media storage backend(local|s3)")
+	flag.StringVar(&settings.storage.dir, "storage-dir", "./uploads", "Directory for the local storage backend")
+	flag.StringVar(&settings.storage.endpoint, "s3-endpoint", "http://localhost:9000", "S3-compatible endpoint URL")
+	flag.StringVar(&settings.storage.region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&settings.storage.bucket, "s3-bucket", "productsreviews", "S3 bucket")
+	flag.StringVar(&settings.storage.accessKey, "s3-access-key", "", "S3 access key")
+	flag.StringVar(&settings.storage.secretKey, "s3-secret-key", "", "S3 secret key")
+	flag.Int64Var(&settings.media.maxBytes, "media-max-bytes", 5_000_000, "Maximum size of an uploaded image in bytes")
+	flag.IntVar(&settings.media.maxDimension, "media-max-dimension", 4096, "Maximum width or height of an uploaded image")
+	flag.IntVar(&settings.media.thumbnailSize, "media-thumbnail-size", 256, "Longest side of generated thumbnails")
+	flag.StringVar(&settings.currency.rounding, "currency-rounding", "half-up", "Rounding for converted prices(half-up|half-even|down|up)")
+	flag.StringVar(&settings.search.language, "search-language", "english", "PostgreSQL text search configuration products and reviews are searched with; changing it rebuilds the search index on start")
+	flag.DurationVar(&settings.reservations.ttl, "reservation-ttl", 15*time.Minute, "How long a stock reservation is held before it expires")
+	flag.DurationVar(&settings.reservations.sweepInterval, "reservation-sweep-interval", time.Minute, "How often expired reservations are released")
+	flag.DurationVar(&settings.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted products and reviews can be restored before they are purged")
+	flag.DurationVar(&settings.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is purged")
+	flag.DurationVar(&settings.similarProducts.interval, "similar-products-interval", time.Hour, "How often similar product recommendations are recomputed")
+	flag.DurationVar(&settings.rankings.interval, "rankings-interval", 15*time.Minute, "How often the trending and top-rated rankings are recomputed")
+	flag.Int64Var(&settings.imports.maxBytes, "import-max-bytes", 100_000_000, "Maximum size of a product import in bytes")
+	flag.StringVar(&settings.orders.checkoutToken, "checkout-token", "", "Bearer token the checkout system sends orders with; orders are refused when empty")
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	intervals := map[string]time.Duration{
+		"reservation-sweep-interval": settings.reservations.sweepInterval,
+		"trash-purge-interval":       settings.trash.purgeInterval,
+		"similar-products-interval":  settings.similarProducts.interval,
+		"rankings-interval":          settings.rankings.interval,
+	}
+	for name, interval := range intervals {
+		if interval <= 0 {
+			logger.Error("interval must be positive", "flag", name, "interval", interval.String())
+			os.Exit(1)
+		}
+	}
+
 	db, err := openDB(settings)
 	if err != nil {
 		logger.Error(err.Error())
@@ -76,11 +175,71 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	var mediaStorage storage.Storage
+	switch settings.storage.backend {
+	case "local":
+		mediaStorage = storage.Local{Root: settings.storage.dir}
+	case "s3":
+		mediaStorage = storage.S3{
+			Endpoint:  settings.storage.endpoint,
+			Region:    settings.storage.region,
+			Bucket:    settings.storage.bucket,
+			AccessKey: settings.storage.accessKey,
+			SecretKey: settings.storage.secretKey,
+		}
+	default:
+		logger.Error("unknown storage backend", "storage", settings.storage.backend)
+		os.Exit(1)
+	}
+
+	if !data.ValidRounding(data.Rounding(settings.currency.rounding)) {
+		logger.Error("unknown currency rounding", "rounding", settings.currency.rounding)
+		os.Exit(1)
+	}
+
 	appInstance := &appDependencies{
-		config:       settings,
-		logger:       logger,
-		productModel: data.ProductModel{DB: db},
-		reviewModel:  data.ReviewModel{DB: db},
+		config:              settings,
+		logger:              logger,
+		storage:             mediaStorage,
+		productModel:        data.ProductModel{DB: db, SearchLanguage: settings.search.language},
+		reviewModel:         data.ReviewModel{DB: db},
+		reviewStatsModel:    data.ReviewStatsModel{DB: db},
+		reviewResponseModel: data.ReviewResponseModel{DB: db},
+		reviewRevisionModel: data.ReviewRevisionModel{DB: db},
+		ratingAspectModel:   data.RatingAspectModel{DB: db},
+		orderModel:          data.OrderModel{DB: db},
+		reviewMediaModel:    data.ReviewMediaModel{DB: db},
+		questionModel:       data.QuestionModel{DB: db},
+		answerModel:         data.AnswerModel{DB: db},
+		categoryModel:       data.CategoryModel{DB: db},
+		exchangeRateModel:   data.ExchangeRateModel{DB: db},
+		priceHistoryModel:   data.PriceHistoryModel{DB: db},
+		productVariantModel: data.ProductVariantModel{DB: db},
+		reservationModel:    data.ReservationModel{DB: db},
+		productImageModel:   data.ProductImageModel{DB: db},
+		searchModel:         data.SearchModel{DB: db, Language: settings.search.language},
+		similarProductModel: data.SimilarProductModel{DB: db},
+		rankingModel:        data.RankingModel{DB: db},
+		productImportModel:  data.ProductImportModel{DB: db},
+		orphanedObjectModel: data.OrphanedObjectModel{DB: db},
+	}
+
+	reindexed, err := appInstance.searchModel.UseLanguage(settings.search.language)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if reindexed {
+		logger.Info("rebuilt the search index", "language", settings.search.language)
+	}
+
+	interrupted, err := appInstance.productImportModel.FailRunning("the import was interrupted by a server restart")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if interrupted > 0 {
+		logger.Info("marked interrupted imports failed", "count", interrupted)
 	}
 
 	err = appInstance.serve()
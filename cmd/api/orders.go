@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// importOrdersHandler ingests orders from the checkout system so reviews by
+// buyers can be marked as verified purchases. Only the checkout system may
+// call it: it must send the configured checkout token as a bearer token.
+func (a *appDependencies) importOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.isCheckout(r) {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Orders []*data.Order `json:"orders"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(incomingData.Orders) > 0, "orders", "must contain at least one order")
+	v.Check(len(incomingData.Orders) <= 1000, "orders", "must not contain more than 1000 orders")
+	for i, order := range incomingData.Orders {
+		data.ValidateOrder(v, order, i)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.orderModel.InsertBatch(incomingData.Orders)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownProduct):
+			a.badRequestResponse(w, r, err)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"imported": len(incomingData.Orders),
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// isCheckout reports whether the request carries the checkout token. No
+// request does when the token is not configured.
+func (a *appDependencies) isCheckout(r *http.Request) bool {
+	expected := a.config.orders.checkoutToken
+	token := a.readBearerToken(r)
+	if expected == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/media"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var tooManyImagesMessage = fmt.Sprintf("a product may have at most %d images", data.MaxProductImages)
+
+func (a *appDependencies) productImageErrResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrImageOrderMismatch):
+		a.failedValidationResponse(w, r, map[string]string{"image_ids": "must list every image of the product exactly once"})
+	case errors.Is(err, data.ErrTooManyImages):
+		a.failedValidationResponse(w, r, map[string]string{"images": tooManyImagesMessage})
+	default:
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// createProductImageHandler adds an image to a product's gallery. A JSON body
+// links an external URL; a multipart/form-data body uploads a single file in
+// the "file" part, with optional "alt_text" and "primary" fields.
+func (a *appDependencies) createProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	image := &data.ProductImage{ProductID: productID}
+	var img *media.Image
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		var ok bool
+		img, ok = a.readProductImageUpload(w, r, image)
+		if !ok {
+			return
+		}
+	} else {
+		var incomingData struct {
+			URL     string `json:"url"`
+			AltText string `json:"alt_text"`
+			Primary bool   `json:"primary"`
+		}
+
+		err = a.readJSON(w, r, &incomingData)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		image.URL = incomingData.URL
+		image.AltText = incomingData.AltText
+		image.Primary = incomingData.Primary
+	}
+
+	if img != nil {
+		image.StorageKey, image.ThumbnailKey, err = a.storeImage(r.Context(), fmt.Sprintf("products/%d", productID), img)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+		image.URL = data.MediaURLPrefix + image.StorageKey
+	}
+
+	v := validator.New()
+	data.ValidateProductImage(v, image)
+	if !v.IsEmpty() {
+		a.removeStoredObjects(r.Context(), image.StorageKey, image.ThumbnailKey)
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.productImageModel.Insert(image)
+	if err != nil {
+		a.removeStoredObjects(r.Context(), image.StorageKey, image.ThumbnailKey)
+		a.productImageErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/images/%d", productID, image.ID))
+
+	data := envelope{
+		"image": image,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// readProductImageUpload reads the multipart form of an image upload into
+// image and returns the processed file. Only one file is accepted, so at most
+// one image is held in memory. It writes the error response itself and
+// reports whether the handler may continue.
+func (a *appDependencies) readProductImageUpload(w http.ResponseWriter, r *http.Request, image *data.ProductImage) (*media.Image, bool) {
+	limits := a.mediaLimits()
+
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBytes+1_000_000)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("the body must be multipart/form-data"))
+		return nil, false
+	}
+
+	var img *media.Image
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				a.badRequestResponse(w, r, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit))
+				return nil, false
+			}
+			a.badRequestResponse(w, r, err)
+			return nil, false
+		}
+
+		switch part.FormName() {
+		case "file":
+			if img != nil {
+				part.Close()
+				a.failedValidationResponse(w, r, map[string]string{"file": "must contain exactly one file"})
+				return nil, false
+			}
+
+			img, err = media.Process(part, limits)
+			part.Close()
+			if err != nil {
+				a.imageProcessErrResponse(w, r, part.FileName(), err)
+				return nil, false
+			}
+		case "alt_text", "primary":
+			value, err := io.ReadAll(io.LimitReader(part, 1024))
+			part.Close()
+			if err != nil {
+				a.badRequestResponse(w, r, err)
+				return nil, false
+			}
+
+			if part.FormName() == "alt_text" {
+				image.AltText = string(value)
+				continue
+			}
+
+			image.Primary, err = strconv.ParseBool(string(value))
+			if err != nil {
+				a.failedValidationResponse(w, r, map[string]string{"primary": "must be a boolean value"})
+				return nil, false
+			}
+		default:
+			part.Close()
+		}
+	}
+
+	if img == nil {
+		a.failedValidationResponse(w, r, map[string]string{"file": "must contain exactly one file"})
+		return nil, false
+	}
+
+	return img, true
+}
+
+func (a *appDependencies) listProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	images, err := a.productImageModel.GetAll(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"images": images,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// updateProductImageHandler changes an image's alt text or makes it the
+// primary image. The primary flag cannot be cleared directly; another image
+// has to be made primary instead.
+func (a *appDependencies) updateProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := a.readInt64Param(r, "imageID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := a.productImageModel.Get(productID, imageID)
+	if err != nil {
+		a.productImageErrResponse(w, r, err)
+		return
+	}
+
+	var incomingData struct {
+		AltText *string `json:"alt_text"`
+		Primary *bool   `json:"primary"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if incomingData.AltText != nil {
+		image.AltText = *incomingData.AltText
+	}
+	if incomingData.Primary != nil {
+		v.Check(*incomingData.Primary || !image.Primary, "primary", "cannot be cleared; make another image primary instead")
+		image.Primary = *incomingData.Primary
+	}
+
+	data.ValidateProductImage(v, image)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.productImageModel.Update(image)
+	if err != nil {
+		a.productImageErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"image": image,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// reorderProductImagesHandler sets the gallery order from a list naming every
+// image of the product.
+func (a *appDependencies) reorderProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		ImageIDs []int64 `json:"image_ids"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateImageOrder(v, incomingData.ImageIDs)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.productImageModel.Reorder(productID, incomingData.ImageIDs)
+	if err != nil {
+		a.productImageErrResponse(w, r, err)
+		return
+	}
+
+	images, err := a.productImageModel.GetAll(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"images": images,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	imageID, err := a.readInt64Param(r, "imageID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	image, err := a.productImageModel.Delete(productID, imageID)
+	if err != nil {
+		a.productImageErrResponse(w, r, err)
+		return
+	}
+
+	a.removeStoredObjects(r.Context(), image.StorageKey, image.ThumbnailKey)
+
+	data := envelope{
+		"message": "image successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+const (
+	// maxSyncImportRows is the most rows a synchronous import may have.
+	// Larger files have to be imported with async=true.
+	maxSyncImportRows = 1000
+
+	// importBatchSize is how many products an async import stores per
+	// transaction, and so how often its progress is saved.
+	importBatchSize = 500
+
+	// maxImportRowErrors caps the row errors kept for an async import. The
+	// failed row count stays exact beyond it.
+	maxImportRowErrors = 1000
+
+	// maxImportLineBytes is the longest NDJSON line an import accepts.
+	maxImportLineBytes = 1_000_000
+
+	// importUploadTimeout replaces the server's read and write timeouts for
+	// imports, whose bodies can be far larger than any other request's.
+	importUploadTimeout = 10 * time.Minute
+)
+
+// productImportRow is one product of an import file. It has the fields of
+// createProductHandler plus the external SKU used to match existing products,
+// but no average rating, which is computed from reviews.
+// problems holds the fields that could not be parsed.
+type productImportRow struct {
+	ExternalSKU string     `json:"external_sku"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Category    string     `json:"category"`
+	Price       data.Money `json:"price"`
+	ImageURL    string     `json:"image_url"`
+	Seller      string     `json:"seller"`
+	Tags        []string   `json:"tags"`
+	Stock       int32      `json:"stock"`
+
+	problems map[string]string
+}
+
+// productRowReader reads an import one row at a time, so that not even an
+// async import holds the whole file in memory. Read returns io.EOF after the
+// last row. Other errors mean the file cannot be read any further; a row
+// that is merely invalid is returned with its problems instead.
+type productRowReader interface {
+	Read() (*productImportRow, error)
+}
+
+// importProductsHandler creates and updates products in bulk from a text/csv
+// or application/x-ndjson body, matching them to existing products on
+// external_sku. By default the import runs in one transaction: if any row is
+// rejected nothing is stored and every row error is reported. With
+// async=true the body is saved and imported in the background in batches,
+// and its progress can be polled at /v1/product-imports/:id. Created products
+// are issued seller tokens like any other; only a synchronous import can
+// return them, since the progress record is not the place to keep secrets.
+func (a *appDependencies) importProductsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	async := a.getOptionalBoolParam(r.URL.Query(), "async", v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	format, err := importFormat(r)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Now().Add(importUploadTimeout))
+	controller.SetWriteDeadline(time.Now().Add(importUploadTimeout))
+	r.Body = http.MaxBytesReader(w, r.Body, a.config.imports.maxBytes)
+
+	if async != nil && *async {
+		a.startProductImport(w, r, format)
+		return
+	}
+
+	rows, err := newProductRowReader(r.Body, format)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	products := []*data.Product{}
+	rowErrors := []*data.ImportRowError{}
+
+	for number := 1; ; number++ {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		if number > maxSyncImportRows {
+			message := fmt.Sprintf("must not contain more than %d rows unless async is true", maxSyncImportRows)
+			a.failedValidationResponse(w, r, map[string]string{"body": message})
+			return
+		}
+
+		product, problems := validateImportRow(row)
+		if len(problems) > 0 {
+			rowErrors = append(rowErrors, &data.ImportRowError{Row: number, ExternalSKU: product.ExternalSKU, Errors: problems})
+			continue
+		}
+		products = append(products, product)
+	}
+
+	if len(products) == 0 && len(rowErrors) == 0 {
+		a.failedValidationResponse(w, r, map[string]string{"body": "must contain at least one row"})
+		return
+	}
+	if len(rowErrors) > 0 {
+		a.errResponseJSON(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+
+	created, failed, err := a.productModel.UpsertBySKU(products, true)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if len(failed) > 0 {
+		for i, product := range products {
+			if failed[i] != nil {
+				rowErrors = append(rowErrors, &data.ImportRowError{Row: i + 1, ExternalSKU: product.ExternalSKU, Errors: importRowProblems(failed[i])})
+			}
+		}
+		a.errResponseJSON(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+
+	data := envelope{
+		"created":  created,
+		"updated":  len(products) - created,
+		"products": products,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// startProductImport saves the body to a temporary file, so that the request
+// can finish, and imports it in the background.
+func (a *appDependencies) startProductImport(w http.ResponseWriter, r *http.Request, format string) {
+	file, err := os.CreateTemp("", "product-import-*")
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	_, err = io.Copy(file, r.Body)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		productImport := &data.ProductImport{Format: format}
+		err = a.productImportModel.Insert(productImport)
+		if err == nil {
+			a.acceptProductImport(w, r, productImport, file)
+			return
+		}
+	}
+
+	file.Close()
+	os.Remove(file.Name())
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		a.badRequestResponse(w, r, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	a.serverErrResponse(w, r, err)
+}
+
+// acceptProductImport starts the background import of file, which it then
+// owns, and tells the client where to poll for its progress. The import stops
+// early if the server shuts down, and is refused if shutdown has already
+// begun.
+func (a *appDependencies) acceptProductImport(w http.ResponseWriter, r *http.Request, productImport *data.ProductImport, file *os.File) {
+	running := *productImport
+	ctx := a.jobsCtx
+
+	started := a.runInBackground("import products", func() error {
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		return a.runProductImport(ctx, &running, file)
+	})
+	if !started {
+		file.Close()
+		os.Remove(file.Name())
+
+		productImport.Status = data.ImportFailed
+		productImport.Error = "the import was refused because the server was shutting down"
+		err := a.productImportModel.Update(productImport)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+
+		a.shuttingDownResponse(w, r)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/product-imports/%d", productImport.ID))
+
+	data := envelope{
+		"import": productImport,
+	}
+	err := a.writeJSON(w, http.StatusAccepted, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// runProductImport imports file and records how it ended. An import that
+// panics is recorded as failed before the panic carries on to runJob.
+func (a *appDependencies) runProductImport(ctx context.Context, productImport *data.ProductImport, file io.Reader) error {
+	defer func() {
+		if err := recover(); err != nil {
+			productImport.Status = data.ImportFailed
+			productImport.Error = "the server encountered a problem and could not finish the import"
+
+			updateErr := a.productImportModel.Update(productImport)
+			if updateErr != nil {
+				a.logger.Error(updateErr.Error(), "import", productImport.ID)
+			}
+			panic(err)
+		}
+	}()
+
+	err := a.importProductBatches(ctx, productImport, file)
+	if err != nil {
+		productImport.Error = "the server encountered a problem and could not finish the import"
+	}
+
+	productImport.Status = data.ImportCompleted
+	if productImport.Error != "" {
+		productImport.Status = data.ImportFailed
+	}
+
+	return errors.Join(err, a.productImportModel.Update(productImport))
+}
+
+// importProductBatches stores the valid rows of file importBatchSize at a
+// time, saving the progress of productImport after every batch. A file that
+// cannot be read to the end, or an import cut short by ctx, is reported in
+// productImport.Error rather than returned as an error.
+func (a *appDependencies) importProductBatches(ctx context.Context, productImport *data.ProductImport, file io.Reader) error {
+	rows, err := newProductRowReader(file, productImport.Format)
+	if err != nil {
+		productImport.Error = err.Error()
+		return nil
+	}
+
+	batch := []*data.Product{}
+	batchRows := []int{}
+
+	flush := func() error {
+		created, failed, err := a.productModel.UpsertBySKU(batch, false)
+		if err != nil {
+			return err
+		}
+
+		for i, product := range batch {
+			if failed[i] != nil {
+				addImportRowError(productImport, batchRows[i], product.ExternalSKU, importRowProblems(failed[i]))
+			}
+		}
+		productImport.Created += created
+		productImport.Updated += len(batch) - created - len(failed)
+
+		batch = batch[:0]
+		batchRows = batchRows[:0]
+
+		return a.productImportModel.Update(productImport)
+	}
+
+	for number := 1; ; number++ {
+		if ctx.Err() != nil {
+			productImport.Error = "the import was interrupted by a server shutdown"
+			break
+		}
+
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			productImport.Error = err.Error()
+			break
+		}
+
+		productImport.Processed++
+
+		product, problems := validateImportRow(row)
+		if len(problems) > 0 {
+			addImportRowError(productImport, number, product.ExternalSKU, problems)
+			continue
+		}
+
+		batch = append(batch, product)
+		batchRows = append(batchRows, number)
+
+		if len(batch) == importBatchSize {
+			err := flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		return flush()
+	}
+	return nil
+}
+
+func addImportRowError(productImport *data.ProductImport, row int, sku string, problems map[string]string) {
+	productImport.Failed++
+	if len(productImport.RowErrors) < maxImportRowErrors {
+		productImport.RowErrors = append(productImport.RowErrors, &data.ImportRowError{Row: row, ExternalSKU: sku, Errors: problems})
+	}
+}
+
+// validateImportRow turns a row into the product it describes, along with
+// every problem that keeps it from being stored.
+func validateImportRow(row *productImportRow) (*data.Product, map[string]string) {
+	product := &data.Product{
+		ExternalSKU: strings.TrimSpace(row.ExternalSKU),
+		Name:        row.Name,
+		Description: row.Description,
+		Category:    data.Slugify(row.Category),
+		Price:       row.Price,
+		ImageURL:    row.ImageURL,
+		Seller:      row.Seller,
+		Tags:        data.NormalizeTags(row.Tags),
+		Stock:       row.Stock,
+	}
+
+	v := validator.New()
+	for key, message := range row.problems {
+		v.AddError(key, message)
+	}
+
+	data.ValidateExternalSKU(v, product.ExternalSKU)
+	data.ValidateImportedProduct(v, product)
+	data.ValidateTags(v, product.Tags)
+	if product.ImageURL != "" {
+		data.ValidateImageURL(v, "image_url", product.ImageURL)
+	}
+
+	return product, v.Errors
+}
+
+// importRowProblems describes why the database rejected an imported product.
+func importRowProblems(err error) map[string]string {
+	switch {
+	case errors.Is(err, data.ErrUnknownCategory):
+		return map[string]string{"category": "must be the slug of an existing category"}
+	case errors.Is(err, data.ErrProductInTrash):
+		return map[string]string{"external_sku": "belongs to a deleted product, which must be restored first"}
+	case errors.Is(err, data.ErrCurrencyHasOverrides):
+		return map[string]string{"currency": "cannot change while variants have price overrides"}
+	case errors.Is(err, data.ErrTooManyImages):
+		return map[string]string{"image_url": tooManyImagesMessage}
+	default:
+		return map[string]string{"row": err.Error()}
+	}
+}
+
+func (a *appDependencies) displayProductImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	productImport, err := a.productImportModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"import": productImport,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// importFormat reads the format of an import from its Content-Type.
+func importFormat(r *http.Request) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return "csv", nil
+	case "application/x-ndjson", "application/ndjson":
+		return "ndjson", nil
+	default:
+		return "", errors.New("the body must be text/csv or application/x-ndjson")
+	}
+}
+
+func newProductRowReader(body io.Reader, format string) (productRowReader, error) {
+	if format == "csv" {
+		return newCSVProductReader(body)
+	}
+	return newNDJSONProductReader(body), nil
+}
+
+// csvImportColumns are the columns a CSV import may have. Each is named after
+// the JSON field it fills in, except that price holds only the amount and
+// currency its currency. Tags are separated by "|".
+var csvImportColumns = []string{"external_sku", "name", "description", "category", "price", "currency", "image_url", "seller", "stock", "tags"}
+
+type csvProductReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+// newCSVProductReader reads the header row, which names the columns of the
+// rows that follow in any order.
+func newCSVProductReader(body io.Reader) (*csvProductReader, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the body must not be empty")
+		}
+		return nil, csvImportError(err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !validator.PermittedValue(column, csvImportColumns...) {
+			return nil, fmt.Errorf("the CSV header contains unknown column %q", column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("the CSV header contains column %q more than once", column)
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+
+	if !seen["external_sku"] {
+		return nil, errors.New("the CSV header must contain an external_sku column")
+	}
+
+	return &csvProductReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvProductReader) Read() (*productImportRow, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, csvImportError(err)
+	}
+
+	row := &productImportRow{problems: make(map[string]string)}
+	price, currency := "0", ""
+
+	for i, column := range c.columns {
+		value := strings.TrimSpace(record[i])
+
+		switch column {
+		case "external_sku":
+			row.ExternalSKU = value
+		case "name":
+			row.Name = value
+		case "description":
+			row.Description = value
+		case "category":
+			row.Category = value
+		case "price":
+			if value != "" {
+				price = value
+			}
+		case "currency":
+			currency = value
+		case "image_url":
+			row.ImageURL = value
+		case "seller":
+			row.Seller = value
+		case "stock":
+			if value != "" {
+				stock, err := strconv.ParseInt(value, 10, 32)
+				if err != nil {
+					row.problems["stock"] = "must be an integer"
+				}
+				row.Stock = int32(stock)
+			}
+		case "tags":
+			if value != "" {
+				row.Tags = strings.Split(value, "|")
+			}
+		}
+	}
+
+	row.Price, err = data.ParseMoney(price, currency)
+	if err != nil {
+		row.problems["price"] = err.Error()
+	}
+
+	return row, nil
+}
+
+func csvImportError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return err
+	case errors.As(err, &maxBytesErr):
+		return fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit)
+	default:
+		return fmt.Errorf("the body contains badly-formed CSV: %w", err)
+	}
+}
+
+type ndjsonProductReader struct {
+	scanner *bufio.Scanner
+}
+
+func newNDJSONProductReader(body io.Reader) *ndjsonProductReader {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+
+	return &ndjsonProductReader{scanner: scanner}
+}
+
+// Read decodes the next non-blank line. Unlike a badly-formed CSV file, a
+// badly-formed line only fails its own row, as the next line is unaffected.
+func (n *ndjsonProductReader) Read() (*productImportRow, error) {
+	for n.scanner.Scan() {
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		row := &productImportRow{}
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+
+		err := decoder.Decode(row)
+		if err == nil && decoder.More() {
+			err = errors.New("must contain a single JSON object")
+		}
+		if err != nil {
+			return &productImportRow{problems: ndjsonRowProblems(err)}, nil
+		}
+
+		return row, nil
+	}
+
+	err := n.scanner.Err()
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case err == nil:
+		return nil, io.EOF
+	case errors.Is(err, bufio.ErrTooLong):
+		return nil, fmt.Errorf("the body contains a line longer than %d bytes", maxImportLineBytes)
+	case errors.As(err, &maxBytesErr):
+		return nil, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit)
+	default:
+		return nil, err
+	}
+}
+
+// ndjsonRowProblems describes a line that could not be decoded, in the terms
+// readJSON uses for a whole body.
+func ndjsonRowProblems(err error) map[string]string {
+	var syntaxErr *json.SyntaxError
+	var unmarshalTypeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return map[string]string{"json": fmt.Sprintf("is badly-formed JSON at character %d", syntaxErr.Offset)}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return map[string]string{"json": "is badly-formed JSON"}
+	case errors.As(err, &unmarshalTypeErr) && unmarshalTypeErr.Field != "":
+		return map[string]string{unmarshalTypeErr.Field: "has the incorrect JSON type"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return map[string]string{"json": "contains unknown key " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return map[string]string{"json": err.Error()}
+	}
+}
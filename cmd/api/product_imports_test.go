@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+)
+
+// readImportRows reads every row of body, stopping at the first error.
+func readImportRows(t *testing.T, body string, format string) ([]*productImportRow, error) {
+	t.Helper()
+
+	rows, err := newProductRowReader(strings.NewReader(body), format)
+	if err != nil {
+		return nil, err
+	}
+
+	all := []*productImportRow{}
+	for {
+		row, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return all, nil
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, row)
+	}
+}
+
+func TestCSVImportHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantErr string
+	}{
+		{"columns in any order", "name,external_sku,price", ""},
+		{"byte order mark and case", "\ufeffExternal_SKU, Name", ""},
+		{"unknown column", "external_sku,colour", `unknown column "colour"`},
+		{"average rating", "external_sku,average_rating", `unknown column "average_rating"`},
+		{"repeated column", "external_sku,name,name", `column "name" more than once`},
+		{"no external_sku", "name,price", "must contain an external_sku column"},
+		{"empty body", "", "must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readImportRows(t, tt.header, "csv")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v; want none", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("got error %v; want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCSVImportRows(t *testing.T) {
+	body := "external_sku,name,price,currency,stock,tags\n" +
+		"KETTLE-1, Kettle ,19.99,eur,5,kitchen|Small Appliances\n" +
+		"KETTLE-2,Kettle,19.999,USD,many,\n" +
+		"KETTLE-3,Kettle,,,,\n"
+
+	rows, err := readImportRows(t, body, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows; want 3", len(rows))
+	}
+
+	first := rows[0]
+	if first.Name != "Kettle" || first.Price != (data.Money{Amount: 1999, Currency: "EUR"}) || first.Stock != 5 {
+		t.Errorf("got row %+v; want the trimmed name, 19.99 EUR and stock 5", first)
+	}
+	if !slices.Equal(first.Tags, []string{"kitchen", "Small Appliances"}) {
+		t.Errorf("got tags %q; want them split on |", first.Tags)
+	}
+	if len(first.problems) != 0 {
+		t.Errorf("got problems %v; want none", first.problems)
+	}
+
+	for _, key := range []string{"price", "stock"} {
+		if rows[1].problems[key] == "" {
+			t.Errorf("got problems %v for the second row; want one for %s", rows[1].problems, key)
+		}
+	}
+
+	if rows[2].Price != (data.Money{Currency: data.DefaultCurrency}) || len(rows[2].problems) != 0 {
+		t.Errorf("got price %+v and problems %v for empty cells; want a zero default-currency price and no problems", rows[2].Price, rows[2].problems)
+	}
+}
+
+func TestCSVImportBadlyFormed(t *testing.T) {
+	body := "external_sku,name\nKETTLE-1,\"Kettle\n"
+
+	_, err := readImportRows(t, body, "csv")
+	if err == nil || !strings.Contains(err.Error(), "badly-formed CSV") {
+		t.Errorf("got error %v; want badly-formed CSV", err)
+	}
+}
+
+func TestNDJSONImportRows(t *testing.T) {
+	body := `{"external_sku": "KETTLE-1", "name": "Kettle", "price": {"amount": "19.99", "currency": "EUR"}}` + "\n" +
+		"\n" +
+		`{"external_sku": "KETTLE-2", "colour": "red"}` + "\n" +
+		`{"external_sku": "KETTLE-3", "stock": "five"}` + "\n" +
+		`{"external_sku": ` + "\n" +
+		`{"external_sku": "KETTLE-5"} {}` + "\n" +
+		`{"external_sku": "KETTLE-6", "average_rating": 4.5}` + "\n"
+
+	rows, err := readImportRows(t, body, "ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("got %d rows; want 6, with the blank line skipped", len(rows))
+	}
+
+	if rows[0].ExternalSKU != "KETTLE-1" || rows[0].Price != (data.Money{Amount: 1999, Currency: "EUR"}) || len(rows[0].problems) != 0 {
+		t.Errorf("got row %+v; want KETTLE-1 at 19.99 EUR", rows[0])
+	}
+
+	tests := []struct {
+		row  int
+		key  string
+		want string
+	}{
+		{1, "json", `contains unknown key "colour"`},
+		{2, "stock", "has the incorrect JSON type"},
+		{3, "json", "is badly-formed JSON"},
+		{4, "json", "must contain a single JSON object"},
+		{5, "json", `contains unknown key "average_rating"`},
+	}
+
+	for _, tt := range tests {
+		if got := rows[tt.row].problems[tt.key]; !strings.Contains(got, tt.want) {
+			t.Errorf("row %d: got problems %v; want %s %q", tt.row+1, rows[tt.row].problems, tt.key, tt.want)
+		}
+	}
+}
+
+func TestNDJSONImportLineTooLong(t *testing.T) {
+	body := `{"name": "` + strings.Repeat("x", maxImportLineBytes) + `"}` + "\n"
+
+	_, err := readImportRows(t, body, "ndjson")
+	if err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("got error %v; want the line reported as too long", err)
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	row := &productImportRow{
+		ExternalSKU: " KETTLE-1 ",
+		Name:        "Kettle",
+		Description: "A kettle",
+		Category:    "Small Appliances",
+		Price:       data.Money{Amount: 1999, Currency: "USD"},
+		Tags:        []string{"Kitchen", "kitchen"},
+	}
+
+	product, problems := validateImportRow(row)
+	if len(problems) != 0 {
+		t.Fatalf("got problems %v for a row without an average rating; want none", problems)
+	}
+	if product.ExternalSKU != "KETTLE-1" || product.Category != "small-appliances" || !slices.Equal(product.Tags, []string{"kitchen"}) {
+		t.Errorf("got sku %q, category %q and tags %q; want them trimmed, slugified and deduplicated", product.ExternalSKU, product.Category, product.Tags)
+	}
+
+	row = &productImportRow{problems: map[string]string{"stock": "must be an integer"}}
+
+	_, problems = validateImportRow(row)
+	for _, key := range []string{"external_sku", "name", "price", "stock"} {
+		if problems[key] == "" {
+			t.Errorf("got problems %v for an empty row; want one for %s", problems, key)
+		}
+	}
+	if _, ok := problems["average_rating"]; ok {
+		t.Errorf("got problems %v; want no average_rating problem on import", problems)
+	}
+}
+
+func TestImportStopsOnShutdown(t *testing.T) {
+	a := &appDependencies{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	productImport := &data.ProductImport{Format: "ndjson"}
+	body := strings.NewReader(`{"external_sku": "KETTLE-1", "name": "Kettle"}` + "\n")
+
+	err := a.importProductBatches(ctx, productImport, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if productImport.Error == "" || productImport.Processed != 0 {
+		t.Errorf("got error %q after %d rows; want the import stopped before any row", productImport.Error, productImport.Processed)
+	}
+}
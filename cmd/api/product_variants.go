@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// readVariant loads the variant named in the URL, making sure it belongs to
+// the product in the URL. It writes the error response itself and reports
+// whether the handler may continue.
+func (a *appDependencies) readVariant(w http.ResponseWriter, r *http.Request) (*data.ProductVariant, bool) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	variantID, err := a.readInt64Param(r, "variantID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	variant, err := a.productVariantModel.Get(productID, variantID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return variant, true
+}
+
+// readPriceOverride decodes a price_override field where an explicit null
+// removes the override.
+func readPriceOverride(raw json.RawMessage) (*data.Money, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	var price data.Money
+	err := json.Unmarshal(raw, &price)
+	if err != nil {
+		return nil, err
+	}
+
+	return &price, nil
+}
+
+func (a *appDependencies) variantErrResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateSKU):
+		a.conflictResponse(w, r, "a variant with this sku already exists")
+	case errors.Is(err, data.ErrStockHeld):
+		a.stockHeldResponse(w, r)
+	default:
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) createVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		SKU           string            `json:"sku"`
+		Options       map[string]string `json:"options"`
+		PriceOverride *data.Money       `json:"price_override"`
+		Stock         int32             `json:"stock"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	product, err := a.productModel.Get(productID)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	variant := &data.ProductVariant{
+		ProductID:     productID,
+		SKU:           incomingData.SKU,
+		Options:       incomingData.Options,
+		PriceOverride: incomingData.PriceOverride,
+		Stock:         incomingData.Stock,
+	}
+
+	v := validator.New()
+	data.ValidateProductVariant(v, variant, product)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.productVariantModel.Insert(variant)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/variants/%d", productID, variant.ID))
+
+	data := envelope{
+		"variant": variant,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayVariantHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := a.readVariant(w, r)
+	if !ok {
+		return
+	}
+
+	data := envelope{
+		"variant": variant,
+	}
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	variants, err := a.productVariantModel.GetAll(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"variants": variants,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateVariantHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := a.readVariant(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		SKU           *string           `json:"sku"`
+		Options       map[string]string `json:"options"`
+		PriceOverride json.RawMessage   `json:"price_override"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.SKU != nil {
+		variant.SKU = *incomingData.SKU
+	}
+	if incomingData.Options != nil {
+		variant.Options = incomingData.Options
+	}
+	if incomingData.PriceOverride != nil {
+		variant.PriceOverride, err = readPriceOverride(incomingData.PriceOverride)
+		if err != nil {
+			a.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	product, err := a.productModel.Get(variant.ProductID)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateProductVariant(v, variant, product)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.productVariantModel.Update(variant)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"variant": variant,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	variantID, err := a.readInt64Param(r, "variantID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.productVariantModel.Delete(productID, variantID)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "variant successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) setVariantStockHandler(w http.ResponseWriter, r *http.Request) {
+	variant, ok := a.readVariant(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Stock *int32 `json:"stock"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Stock == nil {
+		a.badRequestResponse(w, r, errors.New("stock is required"))
+		return
+	}
+
+	v := validator.New()
+	data.ValidateStock(v, *incomingData.Stock)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	variant.Stock, err = a.productVariantModel.SetStock(variant.ProductID, variant.ID, *incomingData.Stock)
+	if err != nil {
+		a.variantErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"variant": variant,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
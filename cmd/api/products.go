@@ -4,21 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/thats-insane/awt-test1/internal/data"
 	"github.com/thats-insane/awt-test1/internal/validator"
 )
 
-var ErrRecordNotFound = errors.New("record not found")
-
 func (a *appDependencies) createProductHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
-		Name          string  `json:"name"`
-		Description   string  `json:"description"`
-		Category      string  `json:"category"`
-		Price         float64 `json:"price"`
-		AverageRating float64 `json:"average_rating"`
-		ImageURL      string  `json:"image_url"`
+		Name          string     `json:"name"`
+		Description   string     `json:"description"`
+		Category      string     `json:"category"`
+		Price         data.Money `json:"price"`
+		AverageRating float64    `json:"average_rating"`
+		ImageURL      string     `json:"image_url"`
+		Seller        string     `json:"seller"`
+		Tags          []string   `json:"tags"`
+		Stock         int32      `json:"stock"`
 	}
 
 	err := a.readJSON(w, r, &incomingData)
@@ -30,14 +33,21 @@ func (a *appDependencies) createProductHandler(w http.ResponseWriter, r *http.Re
 	product := &data.Product{
 		Name:          incomingData.Name,
 		Description:   incomingData.Description,
-		Category:      incomingData.Category,
+		Category:      data.Slugify(incomingData.Category),
 		Price:         incomingData.Price,
 		AverageRating: incomingData.AverageRating,
 		ImageURL:      incomingData.ImageURL,
+		Seller:        incomingData.Seller,
+		Tags:          data.NormalizeTags(incomingData.Tags),
+		Stock:         incomingData.Stock,
 	}
 
 	v := validator.New()
 	data.ValidateProduct(v, product, 1)
+	data.ValidateTags(v, product.Tags)
+	if product.ImageURL != "" {
+		data.ValidateImageURL(v, "image_url", product.ImageURL)
+	}
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
@@ -45,7 +55,12 @@ func (a *appDependencies) createProductHandler(w http.ResponseWriter, r *http.Re
 
 	err = a.productModel.Insert(product)
 	if err != nil {
-		a.serverErrResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUnknownCategory):
+			a.failedValidationResponse(w, r, map[string]string{"category": "must be the slug of an existing category"})
+		default:
+			a.serverErrResponse(w, r, err)
+		}
 		return
 	}
 
@@ -72,10 +87,17 @@ func (a *appDependencies) displayProductHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	v := validator.New()
+	currency := a.requestedCurrency(r, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	product, err := a.productModel.Get(id)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrRecordNotFound):
+		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
 		default:
 			a.serverErrResponse(w, r, err)
@@ -83,11 +105,39 @@ func (a *appDependencies) displayProductHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	product.Variants, err = a.productVariantModel.GetAll(product.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	product.Images, err = a.productImageModel.GetAll(product.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if currency != "" {
+		err = a.convertPrices([]*data.Product{product}, currency)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoExchangeRate):
+				a.failedValidationResponse(w, r, map[string]string{"currency": err.Error()})
+			default:
+				a.serverErrResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Currency")
+
 	data := envelope{
 		"product": product,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -104,7 +154,7 @@ func (a *appDependencies) updateProductHandler(w http.ResponseWriter, r *http.Re
 	product, err := a.productModel.Get(id)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrRecordNotFound):
+		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
 		default:
 			a.serverErrResponse(w, r, err)
@@ -113,12 +163,14 @@ func (a *appDependencies) updateProductHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	var incomingData struct {
-		Name          *string  `json:"name"`
-		Description   *string  `json:"description"`
-		Category      *string  `json:"category"`
-		Price         *float64 `json:"price"`
-		AverageRating *float64 `json:"average_rating"`
-		ImageURL      *string  `json:"image_url"`
+		Name          *string     `json:"name"`
+		Description   *string     `json:"description"`
+		Category      *string     `json:"category"`
+		Price         *data.Money `json:"price"`
+		AverageRating *float64    `json:"average_rating"`
+		ImageURL      *string     `json:"image_url"`
+		Seller        *string     `json:"seller"`
+		Tags          *[]string   `json:"tags"`
 	}
 
 	err = a.readJSON(w, r, &incomingData)
@@ -134,7 +186,7 @@ func (a *appDependencies) updateProductHandler(w http.ResponseWriter, r *http.Re
 		product.Description = *incomingData.Description
 	}
 	if incomingData.Category != nil {
-		product.Category = *incomingData.Category
+		product.Category = data.Slugify(*incomingData.Category)
 	}
 	if incomingData.Price != nil {
 		product.Price = *incomingData.Price
@@ -145,10 +197,20 @@ func (a *appDependencies) updateProductHandler(w http.ResponseWriter, r *http.Re
 	if incomingData.ImageURL != nil {
 		product.ImageURL = *incomingData.ImageURL
 	}
+	if incomingData.Seller != nil {
+		product.Seller = *incomingData.Seller
+	}
+	if incomingData.Tags != nil {
+		product.Tags = data.NormalizeTags(*incomingData.Tags)
+	}
 
 	v := validator.New()
 
 	data.ValidateProduct(v, product, 1)
+	data.ValidateTags(v, product.Tags)
+	if incomingData.ImageURL != nil {
+		data.ValidateImageURL(v, "image_url", product.ImageURL)
+	}
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
@@ -156,7 +218,16 @@ func (a *appDependencies) updateProductHandler(w http.ResponseWriter, r *http.Re
 
 	err = a.productModel.Update(product)
 	if err != nil {
-		a.serverErrResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrUnknownCategory):
+			a.failedValidationResponse(w, r, map[string]string{"category": "must be the slug of an existing category"})
+		case errors.Is(err, data.ErrCurrencyHasOverrides):
+			a.conflictResponse(w, r, "the currency cannot change while variants have price overrides")
+		case errors.Is(err, data.ErrTooManyImages):
+			a.failedValidationResponse(w, r, map[string]string{"image_url": tooManyImagesMessage})
+		default:
+			a.serverErrResponse(w, r, err)
+		}
 		return
 	}
 
@@ -181,7 +252,7 @@ func (a *appDependencies) deleteProductHandler(w http.ResponseWriter, r *http.Re
 	err = a.productModel.Delete(id)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrRecordNotFound):
+		case errors.Is(err, data.ErrRecordNotFound):
 			a.notFoundResponse(w, r)
 		default:
 			a.serverErrResponse(w, r, err)
@@ -201,45 +272,188 @@ func (a *appDependencies) deleteProductHandler(w http.ResponseWriter, r *http.Re
 
 func (a *appDependencies) listProductsHandler(w http.ResponseWriter, r *http.Request) {
 	var queryParamsData struct {
-		Name          string
-		Description   string
-		Category      string
-		Price         string
-		AverageRating string
-		ImageURL      string
+		data.ProductFilter
+		Facets *bool
 		data.Filters
 	}
 
 	queryParams := r.URL.Query()
-	queryParamsData.Name = a.getSingleQueryParam(queryParams, "name", "")
-	queryParamsData.Description = a.getSingleQueryParam(queryParams, "description", "")
-	queryParamsData.Category = a.getSingleQueryParam(queryParams, "category", "")
-	queryParamsData.Price = a.getSingleQueryParam(queryParams, "price", "")
-	queryParamsData.AverageRating = a.getSingleQueryParam(queryParams, "average_rating", "")
-	queryParamsData.ImageURL = a.getSingleQueryParam(queryParams, "image_url", "")
 	v := validator.New()
+	queryParamsData.ProductFilter = a.readProductFilter(queryParams, v)
+	queryParamsData.Facets = a.getOptionalBoolParam(queryParams, "facets", v)
+	currency := a.requestedCurrency(r, v)
 	queryParamsData.Filters.Page = a.getSingleIntParam(queryParams, "page", 1, v)
 	queryParamsData.Filters.PageSize = a.getSingleIntParam(queryParams, "page_size", 10, v)
-	queryParamsData.Filters.Sort = a.getSingleQueryParam(queryParams, "sort", "id")
-	queryParamsData.Filters.SortSafeList = []string{"id", "name", "-id", "-name"}
+	defaultSort := "id"
+	if queryParamsData.Search != "" {
+		defaultSort = "relevance"
+	}
+	queryParamsData.Filters.Sort = a.getSingleQueryParam(queryParams, "sort", defaultSort)
+	queryParamsData.Filters.SortSafeList = []string{"id", "name", "-id", "-name", "relevance"}
 
 	data.ValidateFilters(v, queryParamsData.Filters)
+	v.Check(queryParamsData.Filters.Sort != "relevance" || queryParamsData.Search != "", "sort", "relevance requires a q search")
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	product, metadata, err := a.productModel.GetAll(queryParamsData.Name, queryParamsData.Description, queryParamsData.Category, queryParamsData.Price, queryParamsData.AverageRating, queryParamsData.ImageURL, queryParamsData.Filters)
+	product, metadata, err := a.productModel.GetAll(queryParamsData.ProductFilter, queryParamsData.Filters)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
 	}
 
+	if currency != "" {
+		err = a.convertPrices(product, currency)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrNoExchangeRate):
+				a.failedValidationResponse(w, r, map[string]string{"currency": err.Error()})
+			default:
+				a.serverErrResponse(w, r, err)
+			}
+			return
+		}
+	}
+
 	data := envelope{
 		"product":   product,
 		"@metadata": metadata,
 	}
 
+	if queryParamsData.Facets != nil && *queryParamsData.Facets {
+		queryParamsData.Fuzzy = metadata.Fuzzy
+		facets, err := a.productModel.Facets(queryParamsData.ProductFilter)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+		data["facets"] = facets
+	}
+
+	headers := make(http.Header)
+	headers.Set("Vary", "Accept-Currency")
+
+	err = a.writeJSON(w, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// readProductFilter reads the product filters shared by the list and export
+// endpoints.
+func (a *appDependencies) readProductFilter(queryParams url.Values, v *validator.Validator) data.ProductFilter {
+	filter := data.ProductFilter{
+		Name:              a.getSingleQueryParam(queryParams, "name", ""),
+		Description:       a.getSingleQueryParam(queryParams, "description", ""),
+		Category:          data.Slugify(a.getSingleQueryParam(queryParams, "category", "")),
+		AverageRating:     a.getSingleQueryParam(queryParams, "average_rating", ""),
+		ImageURL:          a.getSingleQueryParam(queryParams, "image_url", ""),
+		Tag:               data.Slugify(a.getSingleQueryParam(queryParams, "tag", "")),
+		Search:            strings.TrimSpace(a.getSingleQueryParam(queryParams, "q", "")),
+		PriceDroppedSince: a.getOptionalDateParam(queryParams, "price_dropped_since", v),
+		InStock:           a.getOptionalBoolParam(queryParams, "in_stock", v),
+	}
+
+	v.Check(len(filter.Search) <= 200, "q", "must not be more than 200 bytes long")
+
+	// price is a decimal amount in price_currency, or the default currency.
+	price := a.getSingleQueryParam(queryParams, "price", "")
+	if price != "" {
+		money, err := data.ParseMoney(price, a.getSingleQueryParam(queryParams, "price_currency", ""))
+		switch {
+		case !data.ValidCurrency(money.Currency):
+			v.AddError("price_currency", "must be a supported ISO 4217 code")
+		case err != nil:
+			v.AddError("price", err.Error())
+		default:
+			filter.Price = &money
+		}
+	}
+
+	return filter
+}
+
+func (a *appDependencies) listPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.Exists(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	changes, err := a.priceHistoryModel.GetAll(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"price_history": changes,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// setProductStockHandler replaces a product's stock count, for example after
+// a delivery or a stocktake.
+func (a *appDependencies) setProductStockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Stock *int32 `json:"stock"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Stock == nil {
+		a.badRequestResponse(w, r, errors.New("stock is required"))
+		return
+	}
+
+	v := validator.New()
+	data.ValidateStock(v, *incomingData.Stock)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	available, err := a.productModel.SetStock(id, *incomingData.Stock)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrStockHeld):
+			a.stockHeldResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"stock": available,
+	}
 	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
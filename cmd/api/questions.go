@@ -0,0 +1,485 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// readQuestion loads the question named in the URL, making sure it belongs to
+// the product in the URL. It writes the error response itself and reports
+// whether the handler may continue.
+func (a *appDependencies) readQuestion(w http.ResponseWriter, r *http.Request) (*data.Question, bool) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	questionID, err := a.readInt64Param(r, "questionID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	question, err := a.questionModel.Get(productID, questionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return question, true
+}
+
+func (a *appDependencies) createQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Author string `json:"author"`
+		Body   string `json:"body"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	question := &data.Question{
+		ProductID: productID,
+		Author:    incomingData.Author,
+		Body:      incomingData.Body,
+	}
+
+	v := validator.New()
+	data.ValidateQuestion(v, question)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.questionModel.Insert(question)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/products/%d/questions/%d", productID, question.ID))
+
+	data := envelope{
+		"question": question,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	question, ok := a.readQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	data := envelope{
+		"question": question,
+	}
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	question, ok := a.readQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Body *string `json:"body"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Body != nil {
+		question.Body = *incomingData.Body
+	}
+
+	v := validator.New()
+	data.ValidateQuestion(v, question)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.questionModel.Update(question)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"question": question,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	questionID, err := a.readInt64Param(r, "questionID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.questionModel.Delete(productID, questionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "question successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listQuestionsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var queryParamsData struct {
+		Body string
+		data.Filters
+	}
+
+	queryParams := r.URL.Query()
+	queryParamsData.Body = a.getSingleQueryParam(queryParams, "body", "")
+	v := validator.New()
+	queryParamsData.Filters.Page = a.getSingleIntParam(queryParams, "page", 1, v)
+	queryParamsData.Filters.PageSize = a.getSingleIntParam(queryParams, "page_size", 10, v)
+	queryParamsData.Filters.Sort = a.getSingleQueryParam(queryParams, "sort", "-created_at")
+	queryParamsData.Filters.SortSafeList = []string{"id", "created_at", "answer_count", "-id", "-created_at", "-answer_count"}
+
+	data.ValidateFilters(v, queryParamsData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	questions, metadata, err := a.questionModel.GetAll(productID, queryParamsData.Body, queryParamsData.Filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"questions": questions,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) createAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	question, ok := a.readQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Author string `json:"author"`
+		Body   string `json:"body"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	product, err := a.productModel.Get(question.ProductID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	// An answer is only marked as the seller's when the request carries the
+	// product's seller token.
+	isSeller, err := a.productModel.SellerTokenMatches(product.ID, a.readBearerToken(r))
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	answer := &data.Answer{
+		QuestionID: question.ID,
+		Author:     incomingData.Author,
+		Body:       incomingData.Body,
+		IsSeller:   product.Seller != "" && isSeller,
+	}
+
+	v := validator.New()
+	data.ValidateAnswer(v, answer)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.answerModel.Insert(answer)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAnswer):
+			a.conflictResponse(w, r, "this author has already answered this question")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"answer": answer,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listAnswersHandler(w http.ResponseWriter, r *http.Request) {
+	question, ok := a.readQuestion(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+
+	queryParams := r.URL.Query()
+	v := validator.New()
+	filters.Page = a.getSingleIntParam(queryParams, "page", 1, v)
+	filters.PageSize = a.getSingleIntParam(queryParams, "page_size", 10, v)
+	filters.Sort = a.getSingleQueryParam(queryParams, "sort", "-upvotes")
+	filters.SortSafeList = []string{"id", "created_at", "upvotes", "-id", "-created_at", "-upvotes"}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	answers, metadata, err := a.answerModel.GetAll(question.ID, filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"answers":   answers,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// readAnswer loads the answer named in the URL under its question and
+// product. It writes the error response itself and reports whether the
+// handler may continue.
+func (a *appDependencies) readAnswer(w http.ResponseWriter, r *http.Request) (*data.Question, *data.Answer, bool) {
+	question, ok := a.readQuestion(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	answerID, err := a.readInt64Param(r, "answerID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	answer, err := a.answerModel.Get(question.ID, answerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return question, answer, true
+}
+
+func (a *appDependencies) upvoteAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	_, answer, ok := a.readAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Voter string `json:"voter"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateVoter(v, incomingData.Voter)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.answerModel.Upvote(answer, incomingData.Voter)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateVote):
+			a.conflictResponse(w, r, "this voter has already upvoted this answer")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"answer": answer,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// acceptAnswerHandler lets the person who asked the question pick the answer
+// that solved it. There is no authentication yet, so the asker is identified
+// by the author in the request body.
+func (a *appDependencies) acceptAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	question, answer, ok := a.readAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	var incomingData struct {
+		Author string `json:"author"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Author != question.Author {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	err = a.answerModel.Accept(answer)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"answer": answer,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	question, answer, ok := a.readAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.answerModel.Delete(question.ID, answer.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "answer successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// listRankingHandler serves the trending and top-rated rails from the
+// rankings the background job last materialised.
+func (a *appDependencies) listRankingHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	ranking := params.ByName("ranking")
+	if !data.ValidRanking(ranking) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	queryParams := r.URL.Query()
+
+	v := validator.New()
+	category := data.Slugify(a.getSingleQueryParam(queryParams, "category", ""))
+	filters := data.Filters{
+		Page:         a.getSingleIntParam(queryParams, "page", 1, v),
+		PageSize:     a.getSingleIntParam(queryParams, "page_size", 10, v),
+		Sort:         "-score",
+		SortSafeList: []string{"-score"},
+	}
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ranked, metadata, err := a.rankingModel.GetAll(ranking, category, filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"products":  ranked,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+func (a *appDependencies) createRatingAspectHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Category string `json:"category"`
+		Name     string `json:"name"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	aspect := &data.RatingAspect{
+		Category: data.Slugify(incomingData.Category),
+		Name:     incomingData.Name,
+	}
+
+	v := validator.New()
+	data.ValidateRatingAspect(v, aspect)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.ratingAspectModel.Insert(aspect)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAspect):
+			a.conflictResponse(w, r, "this category already has an aspect with that name")
+		case errors.Is(err, data.ErrUnknownCategory):
+			a.failedValidationResponse(w, r, map[string]string{"category": "must be the slug of an existing category"})
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/rating-aspects/%d", aspect.ID))
+
+	data := envelope{
+		"rating_aspect": aspect,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listRatingAspectsHandler(w http.ResponseWriter, r *http.Request) {
+	category := data.Slugify(a.getSingleQueryParam(r.URL.Query(), "category", ""))
+
+	aspects, err := a.ratingAspectModel.GetAll(category)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"rating_aspects": aspects,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateRatingAspectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	aspect, err := a.ratingAspectModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	var incomingData struct {
+		Category *string `json:"category"`
+		Name     *string `json:"name"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Category != nil {
+		aspect.Category = data.Slugify(*incomingData.Category)
+	}
+	if incomingData.Name != nil {
+		aspect.Name = *incomingData.Name
+	}
+
+	v := validator.New()
+	data.ValidateRatingAspect(v, aspect)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.ratingAspectModel.Update(aspect)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAspect):
+			a.conflictResponse(w, r, "this category already has an aspect with that name")
+		case errors.Is(err, data.ErrUnknownCategory):
+			a.failedValidationResponse(w, r, map[string]string{"category": "must be the slug of an existing category"})
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"rating_aspect": aspect,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteRatingAspectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.ratingAspectModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "rating aspect successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
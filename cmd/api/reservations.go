@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+func (a *appDependencies) reservationErrResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		a.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrInsufficientStock):
+		a.conflictResponse(w, r, "not enough stock left to reserve that quantity")
+	case errors.Is(err, data.ErrReservationClosed):
+		a.conflictResponse(w, r, "the reservation has already been confirmed, released or expired")
+	default:
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// createReservationHandler holds stock for a checkout. The reservation
+// expires after the configured TTL unless it is confirmed first.
+func (a *appDependencies) createReservationHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		ProductID int64  `json:"product_id"`
+		VariantID *int64 `json:"variant_id"`
+		Quantity  int32  `json:"quantity"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	reservation := &data.Reservation{
+		ProductID: incomingData.ProductID,
+		VariantID: incomingData.VariantID,
+		Quantity:  incomingData.Quantity,
+	}
+
+	v := validator.New()
+	data.ValidateReservation(v, reservation)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.reservationModel.Reserve(reservation, a.config.reservations.ttl)
+	if err != nil {
+		a.reservationErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/reservations/%d", reservation.ID))
+
+	data := envelope{
+		"reservation": reservation,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := a.reservationModel.Get(id)
+	if err != nil {
+		a.reservationErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reservation": reservation,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) confirmReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := a.reservationModel.Confirm(id)
+	if err != nil {
+		a.reservationErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reservation": reservation,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) releaseReservationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reservation, err := a.reservationModel.Release(id)
+	if err != nil {
+		a.reservationErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reservation": reservation,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
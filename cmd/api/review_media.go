@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/media"
+	"github.com/thats-insane/awt-test1/internal/storage"
+)
+
+const maxReviewMedia = 5
+
+// uploadReviewMediaHandler accepts photos as multipart/form-data. Parts are
+// read straight off the request body instead of going through readJSON.
+// Every photo is validated before any is stored, so an upload with one bad
+// file stores nothing; at most maxReviewMedia processed images are held in
+// memory meanwhile.
+func (a *appDependencies) uploadReviewMediaHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.reviewModel.Exists(reviewID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// The count is only used to reject an upload early. InsertBatch checks
+	// the limit again with the review locked.
+	count, err := a.reviewMediaModel.Count(reviewID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	limits := a.mediaLimits()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReviewMedia*limits.MaxBytes+1_000_000)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		a.badRequestResponse(w, r, errors.New("the body must be multipart/form-data"))
+		return
+	}
+
+	images := []*media.Image{}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				a.badRequestResponse(w, r, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit))
+				return
+			}
+			a.badRequestResponse(w, r, err)
+			return
+		}
+
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		if count+len(images) >= maxReviewMedia {
+			part.Close()
+			a.tooManyReviewMediaResponse(w, r)
+			return
+		}
+
+		img, err := media.Process(part, limits)
+		part.Close()
+		if err != nil {
+			a.imageProcessErrResponse(w, r, part.FileName(), err)
+			return
+		}
+
+		images = append(images, img)
+	}
+
+	if len(images) == 0 {
+		a.failedValidationResponse(w, r, map[string]string{"files": "must contain at least one file"})
+		return
+	}
+
+	uploaded, err := a.storeReviewMedia(r.Context(), reviewID, images)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrTooManyMedia):
+			a.tooManyReviewMediaResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"media": uploaded,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) tooManyReviewMediaResponse(w http.ResponseWriter, r *http.Request) {
+	a.failedValidationResponse(w, r, map[string]string{"files": fmt.Sprintf("a review may have at most %d photos", maxReviewMedia)})
+}
+
+func (a *appDependencies) mediaLimits() media.Limits {
+	return media.Limits{
+		MaxBytes:      a.config.media.maxBytes,
+		MaxDimension:  a.config.media.maxDimension,
+		ThumbnailSize: a.config.media.thumbnailSize,
+	}
+}
+
+// imageProcessErrResponse reports a media.Process failure for the named file.
+func (a *appDependencies) imageProcessErrResponse(w http.ResponseWriter, r *http.Request, name string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, media.ErrTooLarge), errors.Is(err, media.ErrUnsupportedType),
+		errors.Is(err, media.ErrTooManyPixels), errors.Is(err, media.ErrInvalidImage):
+		a.failedValidationResponse(w, r, map[string]string{name: err.Error()})
+	case errors.As(err, &maxBytesErr):
+		a.badRequestResponse(w, r, fmt.Errorf("the body must not be larger than %d bytes", maxBytesErr.Limit))
+	default:
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// storeImage writes an image and its thumbnail to storage under a random
+// name below prefix and returns their keys.
+func (a *appDependencies) storeImage(ctx context.Context, prefix string, img *media.Image) (string, string, error) {
+	name := make([]byte, 16)
+	_, err := rand.Read(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	key := prefix + "/" + hex.EncodeToString(name)
+	storageKey := key + img.Extension
+	thumbnailKey := key + "_thumb" + img.Extension
+
+	err = a.storage.Put(ctx, storageKey, img.ContentType, img.Data)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = a.storage.Put(ctx, thumbnailKey, img.ContentType, img.Thumbnail)
+	if err != nil {
+		a.removeStoredObjects(ctx, storageKey)
+		return "", "", err
+	}
+
+	return storageKey, thumbnailKey, nil
+}
+
+// removeStoredObjects deletes objects from storage, logging rather than
+// returning failures since the records pointing at them are already gone.
+func (a *appDependencies) removeStoredObjects(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		err := a.storage.Delete(ctx, key)
+		if err != nil {
+			a.logger.Error(err.Error(), "key", key)
+		}
+	}
+}
+
+// storeReviewMedia writes the images and their thumbnails to storage and
+// records them together. If any write or the insert fails, every object
+// already written is removed again, so a failed upload leaves nothing behind.
+func (a *appDependencies) storeReviewMedia(ctx context.Context, reviewID int64, images []*media.Image) ([]*data.ReviewMedia, error) {
+	uploaded, err := a.storeReviewImages(ctx, reviewID, images)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.reviewMediaModel.InsertBatch(reviewID, uploaded, maxReviewMedia)
+	if err != nil {
+		a.removeReviewMediaObjects(ctx, uploaded)
+		return nil, err
+	}
+
+	return uploaded, nil
+}
+
+// storeReviewImages writes the images and their thumbnails to storage,
+// removing the ones already written if any write fails.
+func (a *appDependencies) storeReviewImages(ctx context.Context, reviewID int64, images []*media.Image) ([]*data.ReviewMedia, error) {
+	uploaded := make([]*data.ReviewMedia, 0, len(images))
+
+	for _, img := range images {
+		storageKey, thumbnailKey, err := a.storeImage(ctx, fmt.Sprintf("reviews/%d", reviewID), img)
+		if err != nil {
+			a.removeReviewMediaObjects(ctx, uploaded)
+			return nil, err
+		}
+
+		uploaded = append(uploaded, &data.ReviewMedia{
+			ReviewID:     reviewID,
+			StorageKey:   storageKey,
+			ThumbnailKey: thumbnailKey,
+			ContentType:  img.ContentType,
+			Width:        img.Width,
+			Height:       img.Height,
+			SizeBytes:    int64(len(img.Data)),
+		})
+	}
+
+	return uploaded, nil
+}
+
+func (a *appDependencies) removeReviewMediaObjects(ctx context.Context, uploaded []*data.ReviewMedia) {
+	for _, reviewMedia := range uploaded {
+		a.removeStoredObjects(ctx, reviewMedia.StorageKey, reviewMedia.ThumbnailKey)
+	}
+}
+
+func (a *appDependencies) deleteReviewMediaHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	mediaID, err := a.readInt64Param(r, "mediaID")
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	reviewMedia, err := a.reviewMediaModel.Get(reviewID, mediaID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.reviewMediaModel.Delete(reviewMedia.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	a.removeStoredObjects(r.Context(), reviewMedia.StorageKey, reviewMedia.ThumbnailKey)
+
+	data := envelope{
+		"message": "media successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// serveMediaHandler streams a stored object back to the client.
+func (a *appDependencies) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	key := strings.TrimPrefix(params.ByName("key"), "/")
+
+	object, err := a.storage.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	_, err = io.Copy(w, object)
+	if err != nil {
+		a.logError(r, err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/thats-insane/awt-test1/internal/media"
+	"github.com/thats-insane/awt-test1/internal/storage"
+)
+
+// failingStorage is local storage that fails every Put after the first
+// allowedPuts.
+type failingStorage struct {
+	storage.Local
+	allowedPuts int
+}
+
+func (s *failingStorage) Put(ctx context.Context, key string, contentType string, data []byte) error {
+	if s.allowedPuts == 0 {
+		return errors.New("storage unavailable")
+	}
+	s.allowedPuts--
+	return s.Local.Put(ctx, key, contentType, data)
+}
+
+func storedFiles(t *testing.T, root string) []string {
+	t.Helper()
+
+	files := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func testImages(n int) []*media.Image {
+	images := make([]*media.Image, n)
+	for i := range images {
+		images[i] = &media.Image{ContentType: "image/jpeg", Extension: ".jpg", Data: []byte("image"), Thumbnail: []byte("thumb")}
+	}
+	return images
+}
+
+func TestStoreReviewImages(t *testing.T) {
+	root := t.TempDir()
+	a := &appDependencies{
+		logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		storage: &failingStorage{Local: storage.Local{Root: root}, allowedPuts: 6},
+	}
+
+	uploaded, err := a.storeReviewImages(context.Background(), 7, testImages(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 3 {
+		t.Fatalf("got %d media; want 3", len(uploaded))
+	}
+	if files := storedFiles(t, root); len(files) != 6 {
+		t.Errorf("got %d stored files; want an image and a thumbnail for each", len(files))
+	}
+}
+
+func TestStoreReviewImagesRollsBack(t *testing.T) {
+	// The third image fails after its own image but before its thumbnail.
+	for _, allowedPuts := range []int{0, 1, 4, 5} {
+		root := t.TempDir()
+		a := &appDependencies{
+			logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+			storage: &failingStorage{Local: storage.Local{Root: root}, allowedPuts: allowedPuts},
+		}
+
+		_, err := a.storeReviewImages(context.Background(), 7, testImages(3))
+		if err == nil {
+			t.Fatalf("with %d puts allowed: got no error", allowedPuts)
+		}
+		if files := storedFiles(t, root); len(files) != 0 {
+			t.Errorf("with %d puts allowed: got %v left in storage; want nothing", allowedPuts, files)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// authorizeSeller checks that the request carries the seller token of the
+// reviewed product as a bearer token, and returns the product. It writes the
+// error response itself and reports whether the handler may continue.
+func (a *appDependencies) authorizeSeller(w http.ResponseWriter, r *http.Request, reviewID int64) (*data.Product, bool) {
+	review, err := a.reviewModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return a.authorizeProductSeller(w, r, review.ProductID)
+}
+
+// authorizeProductSeller checks that the request carries the seller token of
+// the product and returns the product, the same way authorizeSeller does.
+func (a *appDependencies) authorizeProductSeller(w http.ResponseWriter, r *http.Request, productID int64) (*data.Product, bool) {
+	product, err := a.productModel.Get(productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	matches, err := a.productModel.SellerTokenMatches(productID, a.readBearerToken(r))
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return nil, false
+	}
+
+	if product.Seller == "" || !matches {
+		a.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return product, true
+}
+
+func (a *appDependencies) createReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Body string `json:"body"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	product, ok := a.authorizeSeller(w, r, reviewID)
+	if !ok {
+		return
+	}
+
+	response := &data.ReviewResponse{
+		ReviewID: reviewID,
+		Seller:   product.Seller,
+		Body:     incomingData.Body,
+	}
+
+	v := validator.New()
+	data.ValidateReviewResponse(v, response)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.reviewResponseModel.Insert(response)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateResponse):
+			a.conflictResponse(w, r, "this review already has a response")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/reviews/%d/response", reviewID))
+
+	data := envelope{
+		"response": response,
+	}
+	err = a.writeJSON(w, http.StatusCreated, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Body *string `json:"body"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	_, ok := a.authorizeSeller(w, r, reviewID)
+	if !ok {
+		return
+	}
+
+	response, err := a.reviewResponseModel.Get(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if incomingData.Body != nil {
+		response.Body = *incomingData.Body
+	}
+
+	v := validator.New()
+	data.ValidateReviewResponse(v, response)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.reviewResponseModel.Update(response)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"response": response,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteReviewResponseHandler(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	_, ok := a.authorizeSeller(w, r, reviewID)
+	if !ok {
+		return
+	}
+
+	err = a.reviewResponseModel.Delete(reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "response successfully deleted",
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
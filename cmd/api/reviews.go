@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/thats-insane/awt-test1/internal/data"
 	"github.com/thats-insane/awt-test1/internal/validator"
@@ -11,10 +12,12 @@ import (
 
 func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
-		ProductID    *int64  `json:"product_id"`
-		Author       *string `json:"author"`
-		Rating       *int64  `json:"rating"`
-		HelpfulCount *int32  `json:"helpful_count"`
+		ProductID *int64           `json:"product_id"`
+		Author    *string          `json:"author"`
+		Rating    *int64           `json:"rating"`
+		Text      string           `json:"text"`
+		Aspects   map[string]int64 `json:"aspects"`
+		VariantID *int64           `json:"variant_id"`
 	}
 
 	err := a.readJSON(w, r, &incomingData)
@@ -38,19 +41,28 @@ func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if incomingData.HelpfulCount == nil {
-		incomingData.HelpfulCount = new(int32)
+	review := &data.Review{
+		ProductID: *incomingData.ProductID,
+		Author:    *incomingData.Author,
+		Rating:    *incomingData.Rating,
+		Text:      incomingData.Text,
+		Aspects:   incomingData.Aspects,
+		VariantID: incomingData.VariantID,
 	}
 
-	review := &data.Review{
-		ProductID:    *incomingData.ProductID,
-		Author:       *incomingData.Author,
-		Rating:       *incomingData.Rating,
-		HelpfulCount: *incomingData.HelpfulCount,
+	aspects, err := a.ratingAspectModel.GetForProduct(review.ProductID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	data.ValidateReview(v, review)
+	data.ValidateReview(v, review, aspects)
+	err = a.validateReviewVariant(v, review)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
@@ -58,7 +70,12 @@ func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Req
 
 	err = a.reviewModel.Insert(review)
 	if err != nil {
-		a.serverErrResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.conflictingReviewResponse(w, r, review)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
 		return
 	}
 
@@ -77,6 +94,131 @@ func (a *appDependencies) createReviewHandler(w http.ResponseWriter, r *http.Req
 	fmt.Fprintf(w, "%+v\n", incomingData)
 }
 
+// upsertMyReviewHandler creates or replaces the review the caller wrote for
+// the product. There is no authentication yet, so the caller is identified
+// by the author in the request body.
+func (a *appDependencies) upsertMyReviewHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Author    *string          `json:"author"`
+		Rating    *int64           `json:"rating"`
+		Text      string           `json:"text"`
+		Aspects   map[string]int64 `json:"aspects"`
+		VariantID *int64           `json:"variant_id"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Author == nil || incomingData.Rating == nil {
+		a.badRequestResponse(w, r, errors.New("author and rating are required"))
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	review := &data.Review{
+		ProductID: productID,
+		Author:    *incomingData.Author,
+		Rating:    *incomingData.Rating,
+		Text:      incomingData.Text,
+		Aspects:   incomingData.Aspects,
+		VariantID: incomingData.VariantID,
+	}
+
+	aspects, err := a.ratingAspectModel.GetForProduct(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateReview(v, review, aspects)
+	err = a.validateReviewVariant(v, review)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	created, err := a.reviewModel.Upsert(review)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	headers := make(http.Header)
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/review/%d", review.ID))
+	}
+
+	data := envelope{
+		"review": review,
+	}
+	err = a.writeJSON(w, status, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// validateReviewVariant checks that the variant a review is attributed to,
+// if any, belongs to the reviewed product.
+func (a *appDependencies) validateReviewVariant(v *validator.Validator, review *data.Review) error {
+	if review.VariantID == nil {
+		return nil
+	}
+
+	_, err := a.productVariantModel.Get(review.ProductID, *review.VariantID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("variant_id", "must be a variant of the reviewed product")
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// conflictingReviewResponse looks up the review the author already wrote for
+// the product so the 409 can point the client at it. If that review has been
+// deleted since the conflict, the 409 is sent without pointing anywhere.
+func (a *appDependencies) conflictingReviewResponse(w http.ResponseWriter, r *http.Request, review *data.Review) {
+	existing, err := a.reviewModel.GetByAuthor(review.ProductID, review.Author)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.conflictResponse(w, r, "this author has already reviewed this product")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	a.duplicateReviewResponse(w, r, existing.ID)
+}
+
 func (a *appDependencies) displayReviewHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
@@ -124,9 +266,12 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	var incomingData struct {
-		Author       *string `json:"author"`
-		Rating       *int64  `json:"rating"`
-		HelpfulCount *int32  `json:"helpful_count"`
+		Author    *string          `json:"author"`
+		Rating    *int64           `json:"rating"`
+		Text      *string          `json:"text"`
+		Aspects   map[string]int64 `json:"aspects"`
+		VariantID *int64           `json:"variant_id"`
+		Editor    *string          `json:"editor"`
 	}
 
 	err = a.readJSON(w, r, &incomingData)
@@ -135,26 +280,128 @@ func (a *appDependencies) updateReviewHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// Without authentication the editor is whoever the client says it is,
+	// defaulting to the review's original author.
+	editor := review.Author
+	if incomingData.Editor != nil {
+		editor = *incomingData.Editor
+	}
 	if incomingData.Author != nil {
 		review.Author = *incomingData.Author
 	}
 	if incomingData.Rating != nil {
 		review.Rating = *incomingData.Rating
 	}
-	if incomingData.HelpfulCount != nil {
-		review.HelpfulCount = *incomingData.HelpfulCount
+	if incomingData.Text != nil {
+		review.Text = *incomingData.Text
+	}
+	// A variant_id of 0 detaches the review from its variant.
+	if incomingData.VariantID != nil {
+		review.VariantID = incomingData.VariantID
+		if *incomingData.VariantID == 0 {
+			review.VariantID = nil
+		}
+	}
+	// Only the aspects in the request are validated. The stored ones were
+	// valid when they were written, even if the product has since moved to a
+	// category that rates different aspects.
+	storedAspects := review.Aspects
+	review.Aspects = incomingData.Aspects
+
+	aspects, err := a.ratingAspectModel.GetForProduct(review.ProductID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
 	}
 
 	v := validator.New()
-	data.ValidateReview(v, review)
+	data.ValidateReview(v, review, aspects)
+	err = a.validateReviewVariant(v, review)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = a.reviewModel.Update(review)
+	// Update leaves the aspect scores alone unless some were sent, in which
+	// case the sent ones are merged into the stored ones.
+	if review.Aspects != nil {
+		merged := make(map[string]int64, len(storedAspects)+len(review.Aspects))
+		for name, rating := range storedAspects {
+			merged[name] = rating
+		}
+		for name, rating := range review.Aspects {
+			merged[name] = rating
+		}
+		review.Aspects = merged
+	}
+
+	err = a.reviewModel.Update(review, editor)
+	if review.Aspects == nil {
+		review.Aspects = storedAspects
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.conflictingReviewResponse(w, r, review)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"review": review,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) voteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Voter   string `json:"voter"`
+		Helpful *bool  `json:"helpful"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Helpful == nil {
+		a.badRequestResponse(w, r, errors.New("helpful is required"))
+		return
+	}
+
+	v := validator.New()
+	data.ValidateVoter(v, incomingData.Voter)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	review, err := a.reviewModel.Vote(id, incomingData.Voter, *incomingData.Helpful)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateVote):
+			a.conflictResponse(w, r, "this voter has already voted on this review")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
 		return
 	}
 
@@ -196,22 +443,18 @@ func (a *appDependencies) deleteReviewHandler(w http.ResponseWriter, r *http.Req
 
 func (a *appDependencies) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
 	var queryParamsData struct {
-		Author       string
-		Rating       string
-		HelpfulCount string
+		data.ReviewFilter
 		data.Filters
 	}
 
 	queryParams := r.URL.Query()
 
-	queryParamsData.Author = a.getSingleQueryParam(queryParams, "author", "")
-	queryParamsData.Rating = a.getSingleQueryParam(queryParams, "rating", "")
-	queryParamsData.HelpfulCount = a.getSingleQueryParam(queryParams, "helpful_count", "")
 	v := validator.New()
+	queryParamsData.ReviewFilter = a.readReviewFilter(queryParams, v)
 	queryParamsData.Filters.Page = a.getSingleIntParam(queryParams, "page", 1, v)
 	queryParamsData.Filters.PageSize = a.getSingleIntParam(queryParams, "page_size", 10, v)
 	queryParamsData.Filters.Sort = a.getSingleQueryParam(queryParams, "sort", "id")
-	queryParamsData.Filters.SortSafeList = []string{"id", "author", "-id", "-author"}
+	queryParamsData.Filters.SortSafeList = []string{"id", "author", "-id", "-author", "most_helpful", "most_recent", "critical"}
 
 	data.ValidateFilters(v, queryParamsData.Filters)
 	if !v.IsEmpty() {
@@ -219,7 +462,7 @@ func (a *appDependencies) listReviewsHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	reviews, metadata, err := a.reviewModel.GetAll(queryParamsData.Author, queryParamsData.Rating, queryParamsData.HelpfulCount, queryParamsData.Filters)
+	reviews, metadata, err := a.reviewModel.GetAll(queryParamsData.ReviewFilter, queryParamsData.Filters)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -235,3 +478,78 @@ func (a *appDependencies) listReviewsHandler(w http.ResponseWriter, r *http.Requ
 		a.serverErrResponse(w, r, err)
 	}
 }
+
+// readReviewFilter reads the review filters shared by the list and export
+// endpoints.
+func (a *appDependencies) readReviewFilter(queryParams url.Values, v *validator.Validator) data.ReviewFilter {
+	return data.ReviewFilter{
+		Author:       a.getSingleQueryParam(queryParams, "author", ""),
+		Rating:       a.getSingleQueryParam(queryParams, "rating", ""),
+		HelpfulCount: a.getSingleQueryParam(queryParams, "helpful_count", ""),
+		Verified:     a.getOptionalBoolParam(queryParams, "verified", v),
+	}
+}
+
+func (a *appDependencies) displayReviewStatsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	stats, err := a.reviewStatsModel.Get(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review_stats": stats,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listReviewRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	exists, err := a.reviewModel.Exists(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	revisions, err := a.reviewRevisionModel.GetAll(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"revisions": revisions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -14,17 +14,111 @@ func (a *appDependencies) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", a.healthCheckHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/search", a.searchHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/rankings/:ranking", a.listRankingHandler)
+
 	router.HandlerFunc(http.MethodPost, "/v1/product", a.createProductHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/products/:id", a.displayProductHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id", a.namedOrByID(map[string]http.HandlerFunc{
+		"suggest": a.suggestProductsHandler,
+		"export":  a.exportProductsHandler,
+	}, a.displayProductHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id", a.namedOrByID(map[string]http.HandlerFunc{
+		"import": a.importProductsHandler,
+	}, a.notAllowedResponse))
 	router.HandlerFunc(http.MethodPatch, "/v1/products/:id", a.updateProductHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/products/:id", a.deleteProductHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/products", a.listProductsHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/products/:id/reviews/mine", a.upsertMyReviewHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/review-stats", a.displayReviewStatsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/price-history", a.listPriceHistoryHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/products/:id/stock", a.setProductStockHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/restore", a.restoreProductHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/similar", a.listSimilarProductsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/product-imports/:id", a.displayProductImportHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/variants", a.createVariantHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/variants", a.listVariantsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/variants/:variantID", a.displayVariantHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/products/:id/variants/:variantID", a.updateVariantHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/products/:id/variants/:variantID", a.deleteVariantHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/products/:id/variants/:variantID/stock", a.setVariantStockHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/images", a.createProductImageHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/images", a.listProductImagesHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/products/:id/images", a.reorderProductImagesHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/products/:id/images/:imageID", a.updateProductImageHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/products/:id/images/:imageID", a.deleteProductImageHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/questions", a.createQuestionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/questions", a.listQuestionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/questions/:questionID", a.displayQuestionHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/products/:id/questions/:questionID", a.updateQuestionHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/products/:id/questions/:questionID", a.deleteQuestionHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/questions/:questionID/answers", a.createAnswerHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/products/:id/questions/:questionID/answers", a.listAnswersHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/questions/:questionID/answers/:answerID/upvote", a.upvoteAnswerHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/products/:id/questions/:questionID/answers/:answerID/accept", a.acceptAnswerHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/products/:id/questions/:questionID/answers/:answerID", a.deleteAnswerHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/review", a.createReviewHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/review/:id", a.displayReviewHandler)
 	router.HandlerFunc(http.MethodPatch, "/v1/review/:id", a.updateReviewHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/review/:id", a.deleteReviewHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/review/:id/vote", a.voteReviewHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/reviews", a.listReviewsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id", a.namedOrByID(map[string]http.HandlerFunc{
+		"export": a.exportReviewsHandler,
+	}, a.notFoundResponse))
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/response", a.createReviewResponseHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/reviews/:id/response", a.updateReviewResponseHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id/response", a.deleteReviewResponseHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/reviews/:id/revisions", a.listReviewRevisionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/restore", a.restoreReviewHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/reviews/:id/media", a.uploadReviewMediaHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/reviews/:id/media/:mediaID", a.deleteReviewMediaHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/media/*key", a.serveMediaHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/categories", a.createCategoryHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/categories", a.listCategoriesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/categories/:id", a.namedOrByID(map[string]http.HandlerFunc{
+		"tree": a.categoryTreeHandler,
+	}, a.displayCategoryHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/categories/:id", a.updateCategoryHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/categories/:id", a.deleteCategoryHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/rating-aspects", a.createRatingAspectHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/rating-aspects", a.listRatingAspectsHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/rating-aspects/:id", a.updateRatingAspectHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/rating-aspects/:id", a.deleteRatingAspectHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/orders", a.importOrdersHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/reservations", a.createReservationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/reservations/:id", a.displayReservationHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/confirm", a.confirmReservationHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/reservations/:id/release", a.releaseReservationHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/trash/products", a.listTrashedProductsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/admin/trash/reviews", a.listTrashedReviewsHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/exchange-rates", a.importExchangeRatesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/exchange-rates", a.listExchangeRatesHandler)
 
 	return a.recoverPanic(a.rateLimit(router))
 }
+
+// namedOrByID lets fixed paths such as /v1/categories/tree live alongside
+// /v1/categories/:id, which httprouter cannot register side by side. Requests
+// whose :id segment is one of the names go to that handler instead.
+func (a *appDependencies) namedOrByID(named map[string]http.HandlerFunc, byID http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		handler, ok := named[params.ByName("id")]
+		if !ok {
+			handler = byID
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// suggestProductsHandler serves autocomplete for the search box. The results
+// only change when products or categories do, so clients may cache them
+// briefly.
+func (a *appDependencies) suggestProductsHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	v := validator.New()
+	prefix := strings.TrimSpace(a.getSingleQueryParam(queryParams, "prefix", ""))
+	limit := a.getSingleIntParam(queryParams, "limit", 5, v)
+
+	v.Check(prefix != "", "prefix", "must be provided")
+	v.Check(len(prefix) <= 100, "prefix", "must not be more than 100 bytes long")
+	v.Check(limit > 0 && limit <= 20, "limit", "must be between 1 and 20")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := a.productModel.Suggest(prefix, limit)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=60")
+
+	data := envelope{
+		"suggestions": suggestions,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// searchHandler finds products by their own text and through what their
+// reviews say, so "battery life" also turns up products whose reviews discuss
+// it. Review matches are grouped under their product.
+func (a *appDependencies) searchHandler(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	v := validator.New()
+	search := strings.TrimSpace(a.getSingleQueryParam(queryParams, "q", ""))
+	filters := data.Filters{
+		Page:         a.getSingleIntParam(queryParams, "page", 1, v),
+		PageSize:     a.getSingleIntParam(queryParams, "page_size", 10, v),
+		Sort:         a.getSingleQueryParam(queryParams, "sort", "relevance"),
+		SortSafeList: []string{"relevance"},
+	}
+
+	v.Check(search != "", "q", "must be provided")
+	v.Check(len(search) <= 200, "q", "must not be more than 200 bytes long")
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, metadata, err := a.searchModel.Search(search, filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"results":   results,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
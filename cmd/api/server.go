@@ -24,6 +24,11 @@ func (a *appDependencies) serve() error {
 
 	shutdownErr := make(chan error)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	a.jobsCtx = jobsCtx
+	a.startJobs(jobsCtx)
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -33,7 +38,14 @@ func (a *appDependencies) serve() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		shutdownErr <- apiServer.Shutdown(ctx)
+		// The jobs are stopped whether or not every request finished in
+		// time, and the result is sent exactly once.
+		err := apiServer.Shutdown(ctx)
+
+		a.logger.Info("completing background jobs", "address", apiServer.Addr)
+
+		a.stopJobs(stopJobs)
+		shutdownErr <- err
 	}()
 
 	a.logger.Info("starting server", "address", apiServer.Addr, "environment", a.config.env)
@@ -50,5 +62,5 @@ func (a *appDependencies) serve() error {
 
 	a.logger.Info("stopped server", "address", apiServer.Addr)
 
-	return apiServer.ListenAndServe()
+	return nil
 }
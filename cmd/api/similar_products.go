@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// listSimilarProductsHandler serves the recommendations last computed by the
+// background job. A product added since that run has none yet.
+func (a *appDependencies) listSimilarProductsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	limit := a.getSingleIntParam(r.URL.Query(), "limit", 10, v)
+	v.Check(limit > 0 && limit <= 20, "limit", "must be between 1 and 20")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exists, err := a.productModel.Exists(productID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+	if !exists {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	similar, err := a.similarProductModel.GetAll(productID, limit)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"similar": similar,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/awt-test1/internal/data"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// readTrashFilters reads the paging and sorting shared by the trash listings,
+// newest deletions first by default.
+func (a *appDependencies) readTrashFilters(r *http.Request, v *validator.Validator) data.Filters {
+	queryParams := r.URL.Query()
+
+	filters := data.Filters{
+		Page:         a.getSingleIntParam(queryParams, "page", 1, v),
+		PageSize:     a.getSingleIntParam(queryParams, "page_size", 10, v),
+		Sort:         a.getSingleQueryParam(queryParams, "sort", "-deleted_at"),
+		SortSafeList: []string{"id", "deleted_at", "-id", "-deleted_at"},
+	}
+
+	data.ValidateFilters(v, filters)
+	return filters
+}
+
+func (a *appDependencies) listTrashedProductsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := a.readTrashFilters(r, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	products, metadata, err := a.productModel.GetDeleted(filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"products":  products,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listTrashedReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	filters := a.readTrashFilters(r, v)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := a.reviewModel.GetDeleted(filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reviews":   reviews,
+		"@metadata": metadata,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) restoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.productModel.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	product, err := a.productModel.Get(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"product": product,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) restoreReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.reviewModel.Restore(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateReview):
+			a.conflictResponse(w, r, "the author has written a new review of this product since this one was deleted")
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	review, err := a.reviewModel.Get(id)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"review": review,
+	}
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
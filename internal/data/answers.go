@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var ErrDuplicateAnswer = errors.New("duplicate answer")
+
+type Answer struct {
+	ID         int64     `json:"id"`
+	QuestionID int64     `json:"question_id"`
+	Author     string    `json:"author"`
+	Body       string    `json:"body"`
+	Upvotes    int32     `json:"upvotes"`
+	IsSeller   bool      `json:"is_seller"`
+	IsAccepted bool      `json:"is_accepted"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+const answerColumns = `id, question_id, author, body, upvotes, is_seller, is_accepted, created_at, updated_at`
+
+func (answer *Answer) fields() []any {
+	return []any{&answer.ID, &answer.QuestionID, &answer.Author, &answer.Body, &answer.Upvotes, &answer.IsSeller,
+		&answer.IsAccepted, &answer.CreatedAt, &answer.UpdatedAt}
+}
+
+type AnswerModel struct {
+	DB *sql.DB
+}
+
+func (m AnswerModel) Insert(answer *Answer) error {
+	query := `
+	INSERT INTO answers (question_id, author, body, is_seller)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, updated_at
+	`
+	args := []any{answer.QuestionID, answer.Author, answer.Body, answer.IsSeller}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&answer.ID, &answer.CreatedAt, &answer.UpdatedAt)
+	if err != nil {
+		switch {
+		case violates(err, uniqueViolation, "answers_question_author_key"):
+			return ErrDuplicateAnswer
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the answer only if it belongs to the question.
+func (m AnswerModel) Get(questionID int64, id int64) (*Answer, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + answerColumns + `
+	FROM answers
+	WHERE id = $1 AND question_id = $2
+	`
+	var answer Answer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, questionID).Scan(answer.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &answer, nil
+}
+
+// GetAll lists the answers to a question. The accepted answer always comes
+// first, followed by the seller's, then the requested sort order.
+func (m AnswerModel) GetAll(questionID int64, filters Filters) ([]*Answer, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), %s
+	FROM answers
+	WHERE question_id = $1
+	ORDER BY is_accepted DESC, is_seller DESC, %s %s, id ASC
+	LIMIT $2 OFFSET $3`, answerColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, questionID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	answers := []*Answer{}
+
+	for rows.Next() {
+		var answer Answer
+		err := rows.Scan(append([]any{&totalRecords}, answer.fields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		answers = append(answers, &answer)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return answers, metadata, nil
+}
+
+// Upvote records the voter's upvote on the answer. Each voter can upvote an
+// answer once; a second upvote returns ErrDuplicateVote.
+func (m AnswerModel) Upvote(answer *Answer, voter string) error {
+	query := `
+	WITH vote AS (
+		INSERT INTO answer_votes (answer_id, voter)
+		VALUES ($1, $2)
+		ON CONFLICT (answer_id, voter) DO NOTHING
+		RETURNING answer_id
+	)
+	UPDATE answers
+	SET upvotes = upvotes + 1
+	WHERE id = (SELECT answer_id FROM vote)
+	RETURNING upvotes
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, answer.ID, voter).Scan(&answer.Upvotes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDuplicateVote
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Accept marks the answer as the accepted one for its question, clearing any
+// previously accepted answer.
+func (m AnswerModel) Accept(answer *Answer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE answers SET is_accepted = false WHERE question_id = $1 AND is_accepted`, answer.QuestionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE answers SET is_accepted = true WHERE id = $1`, answer.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	answer.IsAccepted = true
+	return nil
+}
+
+func (m AnswerModel) Delete(questionID int64, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM answers
+	WHERE id = $1 AND question_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, questionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateAnswer(v *validator.Validator, answer *Answer) {
+	v.Check(answer.Author != "", "author", "must be provided")
+	v.Check(len(answer.Author) <= 25, "author", "must not be more than 25 bytes long")
+	v.Check(answer.Body != "", "body", "must be provided")
+	v.Check(len(answer.Body) <= 2000, "body", "must not be more than 2000 bytes long")
+}
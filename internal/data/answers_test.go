@@ -0,0 +1,42 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAnswerUpvoteOncePerVoter(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+
+	question := &Question{ProductID: product.ID, Author: "ana", Body: "Does it whistle?"}
+	err := QuestionModel{DB: db}.Insert(question)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answers := AnswerModel{DB: db}
+	answer := &Answer{QuestionID: question.ID, Author: "bo", Body: "Yes"}
+	err = answers.Insert(answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = answers.Upvote(answer, "cy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = answers.Upvote(answer, "cy")
+	if !errors.Is(err, ErrDuplicateVote) {
+		t.Fatalf("got %v; want ErrDuplicateVote", err)
+	}
+
+	err = answers.Upvote(answer, "di")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.Upvotes != 2 {
+		t.Errorf("got %d upvotes; want 2", answer.Upvotes)
+	}
+}
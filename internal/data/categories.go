@@ -0,0 +1,246 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var (
+	ErrDuplicateSlug    = errors.New("duplicate slug")
+	ErrUnknownCategory  = errors.New("unknown category")
+	ErrCategoryInUse    = errors.New("category in use")
+	ErrCategoryCycle    = errors.New("category cycle")
+	slugRX              = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	nonSlugCharactersRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Category struct {
+	ID        int64       `json:"id"`
+	ParentID  *int64      `json:"parent_id"`
+	Name      string      `json:"name"`
+	Slug      string      `json:"slug"`
+	Position  int32       `json:"position"`
+	CreatedAt time.Time   `json:"created_at"`
+	Children  []*Category `json:"children,omitempty"`
+}
+
+// Slugify normalises a category name the same way the category_slug SQL
+// function does, so "Electronics " and "electronics" end up the same.
+func Slugify(value string) string {
+	slug := nonSlugCharactersRX.ReplaceAllString(strings.ToLower(strings.TrimSpace(value)), "-")
+	return strings.Trim(slug, "-")
+}
+
+const categoryColumns = `id, parent_id, name, slug, position, created_at`
+
+func (category *Category) fields() []any {
+	return []any{&category.ID, &category.ParentID, &category.Name, &category.Slug, &category.Position, &category.CreatedAt}
+}
+
+type CategoryModel struct {
+	DB *sql.DB
+}
+
+func (c CategoryModel) Insert(category *Category) error {
+	query := `
+	INSERT INTO categories (parent_id, name, slug, position)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at
+	`
+	args := []any{category.ParentID, category.Name, category.Slug, category.Position}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&category.ID, &category.CreatedAt)
+	if err != nil {
+		return categoryError(err)
+	}
+
+	return nil
+}
+
+func (c CategoryModel) Get(id int64) (*Category, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + categoryColumns + `
+	FROM categories
+	WHERE id = $1
+	`
+	var category Category
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(category.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetAll returns every category as a flat list ordered for display.
+func (c CategoryModel) GetAll() ([]*Category, error) {
+	query := `
+	SELECT ` + categoryColumns + `
+	FROM categories
+	ORDER BY position, name, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*Category{}
+
+	for rows.Next() {
+		var category Category
+		err := rows.Scan(category.fields()...)
+		if err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, &category)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// Tree returns the root categories with their descendants nested under
+// Children, keeping the display order of GetAll at every level.
+func (c CategoryModel) Tree() ([]*Category, error) {
+	categories, err := c.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	roots := []*Category{}
+	for _, category := range categories {
+		parent, ok := byID[derefID(category.ParentID)]
+		if !ok {
+			roots = append(roots, category)
+			continue
+		}
+		parent.Children = append(parent.Children, category)
+	}
+
+	return roots, nil
+}
+
+func derefID(id *int64) int64 {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// Update saves the category, refusing to move it underneath one of its own
+// descendants.
+func (c CategoryModel) Update(category *Category) error {
+	query := `
+	WITH RECURSIVE descendants AS (
+		SELECT id FROM categories WHERE id = $5
+		UNION ALL
+		SELECT c.id FROM categories c JOIN descendants d ON c.parent_id = d.id
+	)
+	UPDATE categories
+	SET parent_id = $1, name = $2, slug = $3, position = $4
+	WHERE id = $5 AND ($1::bigint IS NULL OR $1 NOT IN (SELECT id FROM descendants))
+	RETURNING id
+	`
+	args := []any{category.ParentID, category.Name, category.Slug, category.Position, category.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&category.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCategoryCycle
+		}
+		return categoryError(err)
+	}
+
+	return nil
+}
+
+func (c CategoryModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM categories
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		// Products and subcategories keep a category from being deleted;
+		// any foreign key the delete trips is one of theirs.
+		if raised(err, foreignKeyViolation) {
+			return ErrCategoryInUse
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func categoryError(err error) error {
+	switch {
+	case violates(err, uniqueViolation, "categories_slug_key"):
+		return ErrDuplicateSlug
+	case violates(err, foreignKeyViolation, "categories_parent_id_fkey"):
+		return ErrUnknownCategory
+	default:
+		return err
+	}
+}
+
+func ValidateCategory(v *validator.Validator, category *Category) {
+	v.Check(category.Name != "", "name", "must be provided")
+	v.Check(len(category.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(category.Slug != "", "slug", "must be provided")
+	v.Check(len(category.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(slugRX.MatchString(category.Slug), "slug", "must contain only lowercase letters, digits and single hyphens")
+	v.Check(category.ParentID == nil || *category.ParentID != category.ID, "parent_id", "must not be the category itself")
+}
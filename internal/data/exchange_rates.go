@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var (
+	ErrNoExchangeRate = errors.New("no exchange rate")
+	exchangeRateRX    = regexp.MustCompile(`^[0-9]{1,10}(\.[0-9]{1,10})?$`)
+)
+
+// Rounding decides what happens to the fraction of a minor unit left over
+// after converting between currencies.
+type Rounding string
+
+const (
+	RoundHalfUp   Rounding = "half-up"
+	RoundHalfEven Rounding = "half-even"
+	RoundDown     Rounding = "down"
+	RoundUp       Rounding = "up"
+)
+
+func ValidRounding(rounding Rounding) bool {
+	switch rounding {
+	case RoundHalfUp, RoundHalfEven, RoundDown, RoundUp:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExchangeRate is how many units of To one unit of From buys. Rate is a
+// decimal string so it round-trips through the numeric column unchanged.
+type ExchangeRate struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+	rat       *big.Rat
+}
+
+// ConvertedPrice is a product price expressed in the currency a client
+// asked for, along with the rate used so the client can show its age.
+type ConvertedPrice struct {
+	Price         Money      `json:"price"`
+	Rate          string     `json:"rate"`
+	RateUpdatedAt *time.Time `json:"rate_updated_at,omitempty"`
+}
+
+func (rate *ExchangeRate) value() (*big.Rat, error) {
+	if rate.rat != nil {
+		return rate.rat, nil
+	}
+
+	value, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid exchange rate %q", rate.Rate)
+	}
+	rate.rat = value
+
+	return value, nil
+}
+
+// Convert converts m into the rate's target currency and rounds the result
+// to a whole minor unit of that currency.
+func (m Money) Convert(rate *ExchangeRate, rounding Rounding) (Money, error) {
+	if m.Currency != rate.From {
+		return Money{}, fmt.Errorf("cannot convert %s with a %s rate", m.Currency, rate.From)
+	}
+
+	factor, err := rate.value()
+	if err != nil {
+		return Money{}, err
+	}
+
+	value := new(big.Rat).SetInt64(m.Amount)
+	value.Mul(value, factor)
+	value.Mul(value, big.NewRat(pow10(currencyExponents[rate.To]), pow10(currencyExponents[rate.From])))
+
+	amount := roundRat(value, rounding)
+	if !amount.IsInt64() {
+		return Money{}, fmt.Errorf("converted amount of %s overflows", m)
+	}
+
+	return Money{Amount: amount.Int64(), Currency: rate.To}, nil
+}
+
+func roundRat(value *big.Rat, rounding Rounding) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	awayFromZero := false
+	switch rounding {
+	case RoundDown:
+	case RoundUp:
+		awayFromZero = true
+	default:
+		twice := new(big.Int).Abs(remainder)
+		twice.Lsh(twice, 1)
+		switch twice.Cmp(value.Denom()) {
+		case 1:
+			awayFromZero = true
+		case 0:
+			awayFromZero = rounding == RoundHalfUp || quotient.Bit(0) == 1
+		}
+	}
+
+	if awayFromZero {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+
+	return quotient
+}
+
+// trimDecimal drops the trailing zeros Postgres pads numeric values with.
+func trimDecimal(value string) string {
+	if !strings.Contains(value, ".") {
+		return value
+	}
+	return strings.TrimSuffix(strings.TrimRight(value, "0"), ".")
+}
+
+type ExchangeRateModel struct {
+	DB *sql.DB
+}
+
+// Upsert stores the rates in one transaction, replacing any existing rate
+// for the same pair.
+func (e ExchangeRateModel) Upsert(rates []*ExchangeRate) error {
+	query := `
+	INSERT INTO exchange_rates (from_currency, to_currency, rate)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (from_currency, to_currency) DO UPDATE
+	SET rate = EXCLUDED.rate, updated_at = NOW()
+	RETURNING rate::text, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		err := tx.QueryRowContext(ctx, query, rate.From, rate.To, rate.Rate).Scan(&rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		rate.Rate = trimDecimal(rate.Rate)
+		rate.rat = nil
+	}
+
+	return tx.Commit()
+}
+
+func (e ExchangeRateModel) GetAll() ([]*ExchangeRate, error) {
+	query := `
+	SELECT from_currency, to_currency, rate::text, updated_at
+	FROM exchange_rates
+	ORDER BY from_currency, to_currency
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*ExchangeRate{}
+	for rows.Next() {
+		var rate ExchangeRate
+		err := rows.Scan(&rate.From, &rate.To, &rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rate.Rate = trimDecimal(rate.Rate)
+		rates = append(rates, &rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// Lookup returns the rate for converting each of the from currencies into
+// to, keyed by the from currency. When only the opposite pair is stored it
+// is inverted. Currencies with no usable rate are left out of the map.
+func (e ExchangeRateModel) Lookup(to string, from []string) (map[string]*ExchangeRate, error) {
+	query := `
+	SELECT from_currency, to_currency, rate::text, updated_at
+	FROM exchange_rates
+	WHERE (to_currency = $1 AND from_currency = ANY($2))
+		OR (from_currency = $1 AND to_currency = ANY($2))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, to, pq.Array(from))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make(map[string]*ExchangeRate, len(from))
+	for rows.Next() {
+		var rate ExchangeRate
+		err := rows.Scan(&rate.From, &rate.To, &rate.Rate, &rate.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		rate.Rate = trimDecimal(rate.Rate)
+
+		if rate.To == to {
+			rates[rate.From] = &rate
+			continue
+		}
+
+		if _, ok := rates[rate.To]; ok {
+			continue
+		}
+
+		value, err := rate.value()
+		if err != nil {
+			return nil, err
+		}
+		inverse := new(big.Rat).Inv(value)
+		rates[rate.To] = &ExchangeRate{
+			From:      rate.To,
+			To:        rate.From,
+			Rate:      trimDecimal(inverse.FloatString(10)),
+			UpdatedAt: rate.UpdatedAt,
+			rat:       inverse,
+		}
+	}
+
+	return rates, rows.Err()
+}
+
+func ValidateExchangeRate(v *validator.Validator, rate *ExchangeRate, index int) {
+	key := fmt.Sprintf("rates[%d]", index)
+
+	v.Check(ValidCurrency(rate.From), key+".from", "must be a supported ISO 4217 code")
+	v.Check(ValidCurrency(rate.To), key+".to", "must be a supported ISO 4217 code")
+	v.Check(rate.From != rate.To, key+".to", "must be different from the from currency")
+
+	v.Check(exchangeRateRX.MatchString(rate.Rate), key+".rate", "must be a decimal number with at most 10 digits either side of the point")
+	v.Check(strings.Trim(rate.Rate, "0.") != "", key+".rate", "must be greater than zero")
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// exportBatchSize is how many rows an export fetches from its cursor at a
+	// time, and so the most it holds in memory.
+	exportBatchSize = 500
+
+	// exportTimeout bounds a whole export, which reads every matching row.
+	exportTimeout = 30 * time.Minute
+)
+
+// exportCursor runs query through a server-side cursor and passes each batch
+// of rows it fetches to scanBatch, which reports how many rows it read. The
+// export ends at the first empty batch. The cursor lives in a read-only
+// transaction, which scanBatch is given for any further queries, so the whole
+// export sees a single snapshot.
+func exportCursor(ctx context.Context, db *sql.DB, query string, args []any, scanBatch func(tx *sql.Tx, rows *sql.Rows) (int, error)) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+query, args...)
+	if err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH %d FROM export_cursor`, exportBatchSize)
+
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		count, err := scanBatch(tx, rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return tx.Commit()
+		}
+	}
+}
+
+// Export passes every product matching the filter to emit, in ID order,
+// reading them a batch at a time so that memory use does not grow with the
+// catalog. An error from emit, or ctx being cancelled, stops the export and
+// is returned.
+func (p ProductModel) Export(ctx context.Context, filter ProductFilter, emit func(*Product) error) error {
+	query := `
+	SELECT id, name, description, category, price, currency, average_rating, image_url, seller, stock, COALESCE(external_sku, ''), created_at
+	FROM products
+	WHERE ` + productFilterClause + `
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	return exportCursor(ctx, p.DB, query, filter.args(p.SearchLanguage), func(tx *sql.Tx, rows *sql.Rows) (int, error) {
+		products := []*Product{}
+
+		for rows.Next() {
+			var product Product
+			err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Category, &product.Price.Amount, &product.Price.Currency, &product.AverageRating, &product.ImageURL, &product.Seller, &product.Stock, &product.ExternalSKU, &product.CreatedAt)
+			if err != nil {
+				return 0, err
+			}
+
+			products = append(products, &product)
+		}
+
+		err := rows.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		err = attachAspectAverages(ctx, tx, products)
+		if err != nil {
+			return 0, err
+		}
+
+		err = attachTags(ctx, tx, products)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, product := range products {
+			err := emit(product)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		return len(products), nil
+	})
+}
+
+// Export passes every review matching the filter to emit, in ID order, the
+// same way ProductModel.Export does.
+func (r ReviewModel) Export(ctx context.Context, filter ReviewFilter, emit func(*Review) error) error {
+	query := `
+	SELECT ` + reviewColumns + `
+	FROM reviews
+	WHERE ` + reviewFilterClause + `
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	return exportCursor(ctx, r.DB, query, filter.args(), func(tx *sql.Tx, rows *sql.Rows) (int, error) {
+		reviews := []*Review{}
+
+		for rows.Next() {
+			var review Review
+			err := rows.Scan(review.fields()...)
+			if err != nil {
+				return 0, err
+			}
+
+			reviews = append(reviews, &review)
+		}
+
+		err := rows.Err()
+		if err != nil {
+			return 0, err
+		}
+
+		err = attachResponses(ctx, tx, reviews)
+		if err != nil {
+			return 0, err
+		}
+
+		err = attachAspectRatings(ctx, tx, reviews)
+		if err != nil {
+			return 0, err
+		}
+
+		err = attachMedia(ctx, tx, reviews)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, review := range reviews {
+			err := emit(review)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		return len(reviews), nil
+	})
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestProductExport(t *testing.T) {
+	db := newTestDB(t)
+	products := ProductModel{DB: db, SearchLanguage: "english"}
+
+	kettle := insertTestProduct(t, db, "Kettle")
+	kettle.Tags = []string{"kitchen"}
+	err := products.Update(kettle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertTestProduct(t, db, "Toaster")
+
+	exported := []*Product{}
+	err = products.Export(context.Background(), ProductFilter{}, func(product *Product) error {
+		exported = append(exported, product)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exported) != 2 || exported[0].ID != kettle.ID {
+		t.Fatalf("got %d products; want both, in ID order", len(exported))
+	}
+	if !slices.Equal(exported[0].Tags, []string{"kitchen"}) {
+		t.Errorf("got tags %q; want them attached within the export", exported[0].Tags)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = products.Export(ctx, ProductFilter{}, func(*Product) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v for a cancelled request; want context.Canceled", err)
+	}
+}
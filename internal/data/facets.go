@@ -0,0 +1,134 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// priceBuckets are the upper bounds of the price facet ranges, in major
+// units of each product's currency. Anything at or above the last bound
+// falls into an open-ended range.
+var priceBuckets = []int64{25, 50, 100, 250, 500}
+
+type FacetCount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency,omitempty"`
+	Count    int    `json:"count"`
+}
+
+// Facets counts the products matching a filter by category, tag, price range
+// and whole-star average rating. Category and tag counts are ordered from
+// most to least common, price and rating counts from lowest to highest.
+// Prices in different currencies are never mixed in one range.
+type Facets struct {
+	Category []FacetCount `json:"category"`
+	Tag      []FacetCount `json:"tag"`
+	Price    []FacetCount `json:"price"`
+	Rating   []FacetCount `json:"rating"`
+}
+
+func priceBucketCase() string {
+	var b strings.Builder
+	scale := minorUnitScaleSQL("currency")
+	b.WriteString("CASE")
+	for i, bound := range priceBuckets {
+		fmt.Fprintf(&b, " WHEN price < %d * (%s) THEN %d", bound, scale, i)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", len(priceBuckets))
+	return b.String()
+}
+
+func priceBucketLabel(position int) string {
+	switch {
+	case position == 0:
+		return fmt.Sprintf("0-%d", priceBuckets[0])
+	case position < len(priceBuckets):
+		return fmt.Sprintf("%d-%d", priceBuckets[position-1], priceBuckets[position])
+	default:
+		return fmt.Sprintf("%d+", priceBuckets[len(priceBuckets)-1])
+	}
+}
+
+// Facets computes every facet for the products matching the filter in a
+// single query, so the counts always agree with the list GetAll returns.
+func (p ProductModel) Facets(filter ProductFilter) (*Facets, error) {
+	query := fmt.Sprintf(`
+	WITH filtered AS (
+		SELECT id, category, price, currency, average_rating
+		FROM products
+		WHERE %s
+	)
+	SELECT 'category', category, 0, COUNT(*)
+	FROM filtered
+	GROUP BY category
+	UNION ALL
+	SELECT 'tag', t.slug, 0, COUNT(*)
+	FROM filtered f
+	JOIN product_tags pt ON pt.product_id = f.id
+	JOIN tags t ON t.id = pt.tag_id
+	GROUP BY t.slug
+	UNION ALL
+	SELECT 'price', currency, %s, COUNT(*)
+	FROM filtered
+	GROUP BY 2, 3
+	UNION ALL
+	SELECT 'rating', '', floor(average_rating)::integer, COUNT(*)
+	FROM filtered
+	GROUP BY 3
+	ORDER BY 1, 3, 4 DESC, 2
+	`, productFilterClause, priceBucketCase())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, filter.args(p.SearchLanguage)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &Facets{
+		Category: []FacetCount{},
+		Tag:      []FacetCount{},
+		Price:    []FacetCount{},
+		Rating:   []FacetCount{},
+	}
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+		var position int
+		err := rows.Scan(&facet, &count.Value, &position, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "category":
+			facets.Category = append(facets.Category, count)
+		case "tag":
+			facets.Tag = append(facets.Tag, count)
+		case "price":
+			count.Currency = count.Value
+			count.Value = priceBucketLabel(position)
+			facets.Price = append(facets.Price, count)
+		case "rating":
+			count.Value = fmt.Sprintf("%d", position)
+			facets.Rating = append(facets.Rating, count)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(facets.Price, func(i, j int) bool {
+		return facets.Price[i].Currency < facets.Price[j].Currency
+	})
+
+	return facets, nil
+}
@@ -14,11 +14,13 @@ type Filters struct {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int      `json:"current_page,omitempty"`
+	PageSize     int      `json:"page_size,omitempty"`
+	FirstPage    int      `json:"first_page,omitempty"`
+	LastPage     int      `json:"last_page,omitempty"`
+	TotalRecords int      `json:"total_records,omitempty"`
+	Fuzzy        bool     `json:"fuzzy,omitempty"`
+	DidYouMean   []string `json:"did_you_mean,omitempty"`
 }
 
 func calculateMetaData(totalRecords int, currentPage int, pageSize int) Metadata {
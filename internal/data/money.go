@@ -0,0 +1,210 @@
+package data
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// DefaultCurrency is assumed when a client sends a bare amount instead of an
+// amount and currency pair. Prices stored before currencies were tracked
+// were converted to it.
+const DefaultCurrency = "USD"
+
+// currencyExponents maps the ISO 4217 codes we accept to the number of minor
+// units in one major unit, expressed as a power of ten.
+var currencyExponents = map[string]int{
+	"AED": 2, "ARS": 2, "AUD": 2, "BHD": 3, "BRL": 2, "BZD": 2, "CAD": 2,
+	"CHF": 2, "CLP": 0, "CNY": 2, "COP": 2, "CZK": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "GTQ": 2, "HKD": 2, "HNL": 2, "HUF": 2, "IDR": 2, "ILS": 2,
+	"INR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3,
+	"MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PEN": 2, "PHP": 2,
+	"PLN": 2, "SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2,
+	"TTD": 2, "TWD": 2, "USD": 2, "VND": 0, "XAF": 0, "XCD": 2, "XOF": 0,
+	"ZAR": 2,
+}
+
+// Money is an exact amount of a currency, held as an integer number of minor
+// units (cents for USD, yen for JPY) so that no rounding happens between the
+// client and the database.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+type moneyJSON struct {
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+}
+
+// ValidCurrency reports whether code is an ISO 4217 code we can price in.
+func ValidCurrency(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// Decimal formats the amount in major units with the currency's number of
+// decimal places, e.g. "19.99" for 1999 USD.
+func (m Money) Decimal() string {
+	exponent := currencyExponents[m.Currency]
+	if exponent == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	scale := pow10(exponent)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exponent, amount%scale)
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	output := struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{
+		Amount:   m.Decimal(),
+		Currency: m.Currency,
+	}
+	return json.Marshal(output)
+}
+
+// UnmarshalJSON accepts either {"amount": "19.99", "currency": "EUR"} or a
+// bare amount in the default currency. Amounts may be JSON strings or
+// numbers but are always parsed as exact decimals. An unknown currency is
+// kept as given with a zero amount so that ValidateMoney can report it.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var input moneyJSON
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		err := json.Unmarshal(b, &input)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := json.Unmarshal(b, &input.Amount)
+		if err != nil {
+			return errors.New("money must be a decimal amount or an object with amount and currency")
+		}
+		input.Currency = DefaultCurrency
+	}
+
+	m.Currency = strings.ToUpper(strings.TrimSpace(input.Currency))
+	m.Amount = 0
+
+	exponent, ok := currencyExponents[m.Currency]
+	if !ok {
+		return nil
+	}
+
+	amount, err := parseMinorUnits(input.Amount.String(), exponent)
+	if err != nil {
+		return err
+	}
+	m.Amount = amount
+
+	return nil
+}
+
+// ParseMoney is the counterpart of UnmarshalJSON for amounts and currencies
+// given as separate strings, as in a CSV file. A blank currency means the
+// default one.
+func ParseMoney(amount string, currency string) (Money, error) {
+	m := Money{Currency: strings.ToUpper(strings.TrimSpace(currency))}
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+
+	exponent, ok := currencyExponents[m.Currency]
+	if !ok {
+		return m, nil
+	}
+
+	minorUnits, err := parseMinorUnits(strings.TrimSpace(amount), exponent)
+	if err != nil {
+		return m, err
+	}
+	m.Amount = minorUnits
+
+	return m, nil
+}
+
+// parseMinorUnits converts a decimal string such as "19.99" into minor
+// units, refusing anything that would need rounding.
+func parseMinorUnits(value string, exponent int) (int64, error) {
+	invalid := fmt.Errorf("amount %q must be a decimal number with at most %d decimal places", value, exponent)
+
+	negative := strings.HasPrefix(value, "-")
+	whole, fraction, _ := strings.Cut(strings.TrimPrefix(value, "-"), ".")
+	if whole == "" || len(fraction) > exponent || !digitsOnly(whole) || !digitsOnly(fraction) {
+		return 0, invalid
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return amount, nil
+}
+
+// minorUnitScaleSQL returns an SQL expression giving the number of minor
+// units in one major unit of the currency code held in column.
+func minorUnitScaleSQL(column string) string {
+	codes := make([]string, 0, len(currencyExponents))
+	for code, exponent := range currencyExponents {
+		if exponent != 2 {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CASE %s", column)
+	for _, code := range codes {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", code, pow10(currencyExponents[code]))
+	}
+	b.WriteString(" ELSE 100 END")
+	return b.String()
+}
+
+func digitsOnly(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func pow10(exponent int) int64 {
+	scale := int64(1)
+	for i := 0; i < exponent; i++ {
+		scale *= 10
+	}
+	return scale
+}
+
+func ValidateMoney(v *validator.Validator, key string, money Money) {
+	v.Check(money.Currency != "", key, "currency must be provided")
+	v.Check(money.Currency == "" || ValidCurrency(money.Currency), key, "currency must be a supported ISO 4217 code")
+	v.Check(!ValidCurrency(money.Currency) || money.Amount > 0, key, "amount must be greater than zero")
+}
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"19.99", "usd", Money{1999, "USD"}, false},
+		{"19.9", "", Money{1990, "USD"}, false},
+		{"19", "EUR", Money{1900, "EUR"}, false},
+		{"500", "JPY", Money{500, "JPY"}, false},
+		{"1.234", "BHD", Money{1234, "BHD"}, false},
+		{"-1.50", "USD", Money{-150, "USD"}, false},
+		{"19.999", "USD", Money{Currency: "USD"}, true},
+		{"5.5", "JPY", Money{Currency: "JPY"}, true},
+		{"92233720368547758.08", "USD", Money{Currency: "USD"}, true},
+		{"1e3", "USD", Money{Currency: "USD"}, true},
+		{"--1", "USD", Money{Currency: "USD"}, true},
+		{"", "USD", Money{Currency: "USD"}, true},
+		{"10", "XYZ", Money{Currency: "XYZ"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.amount, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{1999, "USD"}, "19.99"},
+		{Money{5, "USD"}, "0.05"},
+		{Money{-5, "USD"}, "-0.05"},
+		{Money{500, "JPY"}, "500"},
+		{Money{1234, "BHD"}, "1.234"},
+		{Money{-1234, "KWD"}, "-1.234"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%d %s: got %q; want %q", tt.money.Amount, tt.money.Currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{`19.99`, Money{1999, "USD"}, false},
+		{`"19.99"`, Money{1999, "USD"}, false},
+		{`{"amount": "1.5", "currency": "eur"}`, Money{150, "EUR"}, false},
+		{`{"amount": 300, "currency": "JPY"}`, Money{300, "JPY"}, false},
+		{`{"amount": "1", "currency": "XYZ"}`, Money{0, "XYZ"}, false},
+		{`19.999`, Money{}, true},
+		{`true`, Money{}, true},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.input), &got)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v; want error %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("%s: got %+v; want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyConvertRounding(t *testing.T) {
+	tests := []struct {
+		name     string
+		money    Money
+		rate     string
+		to       string
+		rounding Rounding
+		want     int64
+	}{
+		{"half-up rounds a half away from zero", Money{1, "USD"}, "0.5", "EUR", RoundHalfUp, 1},
+		{"half-even rounds a half to even", Money{1, "USD"}, "0.5", "EUR", RoundHalfEven, 0},
+		{"half-even rounds an odd half up", Money{3, "USD"}, "0.5", "EUR", RoundHalfEven, 2},
+		{"down truncates", Money{199, "USD"}, "0.999", "EUR", RoundDown, 198},
+		{"up rounds away from zero", Money{101, "USD"}, "0.99", "EUR", RoundUp, 100},
+		{"negative half-up", Money{-1, "USD"}, "0.5", "EUR", RoundHalfUp, -1},
+		{"into a currency without minor units", Money{1999, "USD"}, "150", "JPY", RoundHalfUp, 2999},
+		{"into a currency with three decimals", Money{1000, "USD"}, "0.3770", "BHD", RoundHalfUp, 3770},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := &ExchangeRate{From: tt.money.Currency, To: tt.to, Rate: tt.rate}
+
+			got, err := tt.money.Convert(rate, tt.rounding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Amount != tt.want || got.Currency != tt.to {
+				t.Errorf("got %+v; want %d %s", got, tt.want, tt.to)
+			}
+		})
+	}
+}
+
+func TestMoneyConvertOverflow(t *testing.T) {
+	rate := &ExchangeRate{From: "USD", To: "JPY", Rate: "1000"}
+
+	_, err := Money{Amount: 1 << 62, Currency: "USD"}.Convert(rate, RoundHalfUp)
+	if err == nil {
+		t.Error("got no error converting an amount that overflows int64")
+	}
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var ErrUnknownProduct = errors.New("unknown product")
+
+// Order is a purchase reported by the checkout system. It is only used to
+// decide whether a review comes from a verified buyer.
+type Order struct {
+	ID         int64       `json:"id"`
+	ExternalID string      `json:"external_id"`
+	Customer   string      `json:"customer"`
+	PlacedAt   time.Time   `json:"placed_at"`
+	Items      []OrderItem `json:"items"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+type OrderItem struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int32 `json:"quantity"`
+}
+
+type OrderModel struct {
+	DB *sql.DB
+}
+
+// InsertBatch stores the orders in one transaction. Orders are keyed by
+// their external ID, so re-sending an order replaces it instead of
+// duplicating it.
+func (m OrderModel) InsertBatch(orders []*Order) error {
+	orderQuery := `
+	INSERT INTO orders (external_id, customer, placed_at)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (external_id) DO UPDATE
+	SET customer = EXCLUDED.customer, placed_at = EXCLUDED.placed_at
+	RETURNING id, created_at
+	`
+	itemQuery := `
+	INSERT INTO order_items (order_id, product_id, quantity)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (order_id, product_id) DO UPDATE
+	SET quantity = order_items.quantity + EXCLUDED.quantity
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, order := range orders {
+		err := tx.QueryRowContext(ctx, orderQuery, order.ExternalID, order.Customer, order.PlacedAt).Scan(&order.ID, &order.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM order_items WHERE order_id = $1`, order.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			_, err := tx.ExecContext(ctx, itemQuery, order.ID, item.ProductID, item.Quantity)
+			if err != nil {
+				switch {
+				case violates(err, foreignKeyViolation, "order_items_product_id_fkey"):
+					return fmt.Errorf("%w: %d", ErrUnknownProduct, item.ProductID)
+				default:
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func ValidateOrder(v *validator.Validator, order *Order, index int) {
+	key := fmt.Sprintf("orders[%d]", index)
+
+	v.Check(order.ExternalID != "", key+".external_id", "must be provided")
+	v.Check(len(order.ExternalID) <= 100, key+".external_id", "must not be more than 100 bytes long")
+	v.Check(order.Customer != "", key+".customer", "must be provided")
+	v.Check(!order.PlacedAt.IsZero(), key+".placed_at", "must be provided")
+	v.Check(len(order.Items) > 0, key+".items", "must contain at least one item")
+
+	for i, item := range order.Items {
+		v.Check(item.ProductID > 0, fmt.Sprintf("%s.items[%d].product_id", key, i), "must be a positive integer")
+		v.Check(item.Quantity > 0, fmt.Sprintf("%s.items[%d].quantity", key, i), "must be greater than zero")
+	}
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OrphanedObjectModel reads the storage keys that database triggers queue
+// whenever a review photo or product image row is deleted.
+type OrphanedObjectModel struct {
+	DB *sql.DB
+}
+
+// Pending returns up to limit queued keys, oldest first.
+func (m OrphanedObjectModel) Pending(limit int) ([]string, error) {
+	query := `
+	SELECT storage_key
+	FROM orphaned_objects
+	ORDER BY created_at, storage_key
+	LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Forget removes keys whose objects have been deleted from storage.
+func (m OrphanedObjectModel) Forget(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM orphaned_objects WHERE storage_key = ANY($1)`, pq.Array(keys))
+	return err
+}
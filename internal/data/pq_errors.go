@@ -0,0 +1,33 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// SQLSTATE codes of the database errors the models turn into domain errors.
+const (
+	foreignKeyViolation pq.ErrorCode = "23503"
+	uniqueViolation     pq.ErrorCode = "23505"
+	undefinedObject     pq.ErrorCode = "42704"
+
+	// currencyHasOverrides is raised by the products_currency_change
+	// trigger.
+	currencyHasOverrides pq.ErrorCode = "PV001"
+)
+
+// violates reports whether err is a PostgreSQL error with the given SQLSTATE
+// code raised by constraint. A violated unique index is reported under the
+// index's name, so constraint can name either.
+func violates(err error, code pq.ErrorCode, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code && pqErr.Constraint == constraint
+}
+
+// raised reports whether err is a PostgreSQL error with the given SQLSTATE
+// code, whichever constraint or trigger raised it.
+func raised(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
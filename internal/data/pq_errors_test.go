@@ -0,0 +1,49 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestViolates(t *testing.T) {
+	duplicate := &pq.Error{Code: uniqueViolation, Constraint: "reviews_product_author_key", Message: "any wording"}
+
+	tests := []struct {
+		name       string
+		err        error
+		code       pq.ErrorCode
+		constraint string
+		want       bool
+	}{
+		{"matching", duplicate, uniqueViolation, "reviews_product_author_key", true},
+		{"wrapped", fmt.Errorf("insert: %w", duplicate), uniqueViolation, "reviews_product_author_key", true},
+		{"other constraint", duplicate, uniqueViolation, "categories_slug_key", false},
+		{"other code", duplicate, foreignKeyViolation, "reviews_product_author_key", false},
+		{"not a database error", errors.New(`pq: duplicate key value violates unique constraint "reviews_product_author_key"`), uniqueViolation, "reviews_product_author_key", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := violates(tt.err, tt.code, tt.constraint); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaised(t *testing.T) {
+	overrides := &pq.Error{Code: currencyHasOverrides, Message: "any wording"}
+
+	if !raised(fmt.Errorf("update: %w", overrides), currencyHasOverrides) {
+		t.Error("got a wrapped trigger error not recognised")
+	}
+	if raised(overrides, uniqueViolation) {
+		t.Error("got a trigger error recognised under another code")
+	}
+	if raised(errors.New("pq: cannot change the currency of a product whose variants have price overrides"), currencyHasOverrides) {
+		t.Error("got a plain error recognised by its message")
+	}
+}
@@ -0,0 +1,81 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PriceChange is a price a product had from EffectiveAt until the next
+// change.
+type PriceChange struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"product_id"`
+	Price       Money     `json:"price"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+type PriceHistoryModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every price the product has had, newest first.
+func (m PriceHistoryModel) GetAll(productID int64) ([]*PriceChange, error) {
+	query := `
+	SELECT id, product_id, price, currency, effective_at
+	FROM price_history
+	WHERE product_id = $1
+	ORDER BY effective_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*PriceChange{}
+
+	for rows.Next() {
+		var change PriceChange
+		err := rows.Scan(&change.ID, &change.ProductID, &change.Price.Amount, &change.Price.Currency, &change.EffectiveAt)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// recordPriceChange adds the product's price to its history unless it is
+// the same as the latest recorded price.
+func recordPriceChange(ctx context.Context, tx *sql.Tx, product *Product) error {
+	query := `
+	INSERT INTO price_history (product_id, price, currency)
+	SELECT $1::bigint, $2::bigint, $3::text
+	WHERE NOT EXISTS (
+		SELECT 1
+		FROM (
+			SELECT price, currency
+			FROM price_history
+			WHERE product_id = $1
+			ORDER BY effective_at DESC, id DESC
+			LIMIT 1
+		) latest
+		WHERE latest.price = $2 AND latest.currency = $3
+	)
+	`
+
+	_, err := tx.ExecContext(ctx, query, product.ID, product.Price.Amount, product.Price.Currency)
+	return err
+}
@@ -0,0 +1,453 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// MaxProductImages is how many images a product's gallery may hold.
+const MaxProductImages = 20
+
+var (
+	ErrImageOrderMismatch = errors.New("image order does not list every image exactly once")
+	ErrTooManyImages      = errors.New("too many images")
+)
+
+// ProductImage is one picture in a product's gallery. It either points at an
+// external URL or at an uploaded file in the storage backend, in which case
+// StorageKey is set and URL is where the API serves it. Exactly one image per
+// product is primary once it has any, and products.image_url mirrors its URL.
+type ProductImage struct {
+	ID           int64     `json:"id"`
+	ProductID    int64     `json:"product_id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	AltText      string    `json:"alt_text"`
+	Position     int32     `json:"position"`
+	Primary      bool      `json:"primary"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const productImageColumns = `id, product_id, url, storage_key, thumbnail_key, alt_text, position, is_primary, created_at, updated_at`
+
+func (image *ProductImage) fields() []any {
+	return []any{&image.ID, &image.ProductID, &image.URL, &image.StorageKey, &image.ThumbnailKey,
+		&image.AltText, &image.Position, &image.Primary, &image.CreatedAt, &image.UpdatedAt}
+}
+
+func (image *ProductImage) setThumbnailURL() {
+	if image.ThumbnailKey != "" {
+		image.ThumbnailURL = MediaURLPrefix + image.ThumbnailKey
+	}
+}
+
+// lockProduct serialises gallery changes for a product so that positions and
+// the primary flag are worked out against a stable set of images.
+func lockProduct(ctx context.Context, tx *sql.Tx, productID int64) error {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM products WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, productID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// syncPrimaryImage copies the primary image's URL into products.image_url.
+func syncPrimaryImage(ctx context.Context, tx *sql.Tx, productID int64) error {
+	query := `
+	UPDATE products
+	SET image_url = COALESCE((SELECT url FROM product_images WHERE product_id = $1 AND is_primary), '')
+	WHERE id = $1
+	`
+	_, err := tx.ExecContext(ctx, query, productID)
+	return err
+}
+
+// setPrimaryImageURL keeps the old single image_url field working. A new URL
+// replaces the primary image when that is an external link, and otherwise is
+// added to the gallery as the new primary image.
+func setPrimaryImageURL(ctx context.Context, tx *sql.Tx, productID int64, imageURL string) error {
+	if imageURL == "" {
+		return nil
+	}
+
+	var current ProductImage
+	query := `
+	SELECT ` + productImageColumns + `
+	FROM product_images
+	WHERE product_id = $1 AND is_primary
+	`
+	err := tx.QueryRowContext(ctx, query, productID).Scan(current.fields()...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	case current.URL == imageURL:
+		return nil
+	case current.StorageKey == "":
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET url = $1, updated_at = NOW() WHERE id = $2`, imageURL, current.ID)
+		if err != nil {
+			return err
+		}
+		return syncPrimaryImage(ctx, tx, productID)
+	}
+
+	image := &ProductImage{ProductID: productID, URL: imageURL, Primary: true}
+	err = insertProductImage(ctx, tx, image)
+	if err != nil {
+		return err
+	}
+
+	return syncPrimaryImage(ctx, tx, productID)
+}
+
+// insertProductImage appends image to the end of the gallery. The first image
+// a product gets is always primary. The product row is locked while its images
+// are counted, so concurrent inserts cannot take it past MaxProductImages
+// between them; ErrTooManyImages is returned instead.
+func insertProductImage(ctx context.Context, tx *sql.Tx, image *ProductImage) error {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+	SELECT (SELECT COUNT(*) FROM product_images WHERE product_id = p.id)
+	FROM products p
+	WHERE p.id = $1
+	FOR UPDATE OF p
+	`, image.ProductID).Scan(&count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if count >= MaxProductImages {
+		return ErrTooManyImages
+	}
+
+	if image.Primary {
+		_, err := tx.ExecContext(ctx, `UPDATE product_images SET is_primary = false, updated_at = NOW() WHERE product_id = $1 AND is_primary`, image.ProductID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+	INSERT INTO product_images (product_id, url, storage_key, thumbnail_key, alt_text, position, is_primary)
+	VALUES ($1, $2, $3, $4, $5,
+		(SELECT COALESCE(MAX(position) + 1, 0) FROM product_images WHERE product_id = $1),
+		$6 OR NOT EXISTS (SELECT 1 FROM product_images WHERE product_id = $1 AND is_primary))
+	RETURNING ` + productImageColumns + `
+	`
+	args := []any{image.ProductID, image.URL, image.StorageKey, image.ThumbnailKey, image.AltText, image.Primary}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(image.fields()...)
+	if err != nil {
+		return err
+	}
+
+	image.setThumbnailURL()
+	return nil
+}
+
+type ProductImageModel struct {
+	DB *sql.DB
+}
+
+func (m ProductImageModel) Insert(image *ProductImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	err = insertProductImage(ctx, tx, image)
+	if err != nil {
+		return err
+	}
+
+	err = syncPrimaryImage(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ProductImageModel) Get(productID int64, id int64) (*ProductImage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + productImageColumns + `
+	FROM product_images
+	WHERE id = $1 AND product_id = $2
+	`
+	var image ProductImage
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, productID).Scan(image.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	image.setThumbnailURL()
+	return &image, nil
+}
+
+// GetAll lists a product's gallery in display order.
+func (m ProductImageModel) GetAll(productID int64) ([]*ProductImage, error) {
+	query := `
+	SELECT ` + productImageColumns + `
+	FROM product_images
+	WHERE product_id = $1
+	ORDER BY position, id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*ProductImage{}
+
+	for rows.Next() {
+		var image ProductImage
+		err := rows.Scan(image.fields()...)
+		if err != nil {
+			return nil, err
+		}
+
+		image.setThumbnailURL()
+		images = append(images, &image)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// Update saves the alt text and, when the image is made primary, moves the
+// primary flag over to it.
+func (m ProductImageModel) Update(image *ProductImage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	if image.Primary {
+		_, err = tx.ExecContext(ctx, `UPDATE product_images SET is_primary = false, updated_at = NOW() WHERE product_id = $1 AND is_primary AND id <> $2`, image.ProductID, image.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+	UPDATE product_images
+	SET alt_text = $1, is_primary = $2, updated_at = NOW()
+	WHERE id = $3 AND product_id = $4
+	RETURNING updated_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, image.AltText, image.Primary, image.ID, image.ProductID).Scan(&image.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	err = syncPrimaryImage(ctx, tx, image.ProductID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder sets the gallery order to that of ids, which must name every image
+// of the product exactly once.
+func (m ProductImageModel) Reorder(productID int64, ids []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, productID)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM product_images WHERE product_id = $1`, productID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != len(ids) {
+		return ErrImageOrderMismatch
+	}
+
+	query := `
+	UPDATE product_images i
+	SET position = o.ordinality - 1, updated_at = NOW()
+	FROM unnest($2::bigint[]) WITH ORDINALITY AS o(id, ordinality)
+	WHERE i.id = o.id AND i.product_id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, productID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected != int64(len(ids)) {
+		return ErrImageOrderMismatch
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an image and returns it so the caller can remove any stored
+// files. Deleting the primary image promotes the first remaining one.
+func (m ProductImageModel) Delete(productID int64, id int64) (*ProductImage, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockProduct(ctx, tx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	DELETE FROM product_images
+	WHERE id = $1 AND product_id = $2
+	RETURNING ` + productImageColumns + `
+	`
+	var image ProductImage
+
+	err = tx.QueryRowContext(ctx, query, id, productID).Scan(image.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if image.Primary {
+		query = `
+		UPDATE product_images
+		SET is_primary = true, updated_at = NOW()
+		WHERE id = (SELECT id FROM product_images WHERE product_id = $1 ORDER BY position, id LIMIT 1)
+		`
+		_, err = tx.ExecContext(ctx, query, productID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = syncPrimaryImage(ctx, tx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	image.setThumbnailURL()
+	return &image, nil
+}
+
+// ValidImageURL reports whether value is an absolute http or https URL.
+func ValidImageURL(value string) bool {
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func ValidateImageURL(v *validator.Validator, key string, value string) {
+	v.Check(value != "", key, "must be provided")
+	v.Check(len(value) <= 2048, key, "must not be more than 2048 bytes long")
+	v.Check(value == "" || ValidImageURL(value), key, "must be an absolute http or https URL")
+}
+
+func ValidateProductImage(v *validator.Validator, image *ProductImage) {
+	if image.StorageKey == "" {
+		ValidateImageURL(v, "url", image.URL)
+	}
+	v.Check(len(image.AltText) <= 250, "alt_text", "must not be more than 250 bytes long")
+}
+
+func ValidateImageOrder(v *validator.Validator, ids []int64) {
+	v.Check(len(ids) > 0, "image_ids", "must contain at least one image id")
+
+	seen := make(map[int64]bool, len(ids))
+	for i, id := range ids {
+		key := fmt.Sprintf("image_ids[%d]", i)
+		v.Check(id > 0, key, "must be a positive integer")
+		v.Check(!seen[id], key, "must not be repeated")
+		seen[id] = true
+	}
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestProductImageLimit(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+
+	images := ProductImageModel{DB: db}
+
+	for i := 0; i < MaxProductImages; i++ {
+		err := images.Insert(&ProductImage{ProductID: product.ID, URL: fmt.Sprintf("https://example.com/%d.jpg", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := images.Insert(&ProductImage{ProductID: product.ID, URL: "https://example.com/extra.jpg"})
+	if !errors.Is(err, ErrTooManyImages) {
+		t.Fatalf("got %v; want ErrTooManyImages", err)
+	}
+
+	// A new image_url replaces an external primary image in place, so it
+	// still fits; make the primary an upload so that it has to be added.
+	_, err = db.Exec(`UPDATE product_images SET storage_key = 'products/test/1.jpg' WHERE product_id = $1 AND is_primary`, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product.ImageURL = "https://example.com/new.jpg"
+	err = ProductModel{DB: db}.Update(product)
+	if !errors.Is(err, ErrTooManyImages) {
+		t.Fatalf("got %v from Update; want ErrTooManyImages", err)
+	}
+
+	all, err := images.GetAll(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != MaxProductImages {
+		t.Errorf("got %d images; want %d", len(all), MaxProductImages)
+	}
+}
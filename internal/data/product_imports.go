@@ -0,0 +1,299 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var (
+	ErrProductInTrash  = errors.New("product is in the trash")
+	ErrProductRejected = errors.New("rejected by the database")
+)
+
+// Statuses of a product import.
+const (
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportRowError explains why a row of an import was not stored. Rows are
+// numbered from 1 and a CSV header row is not counted.
+type ImportRowError struct {
+	Row         int               `json:"row"`
+	ExternalSKU string            `json:"external_sku,omitempty"`
+	Errors      map[string]string `json:"errors"`
+}
+
+// ProductImport is the progress of an import running in the background.
+// Error is set when the import as a whole stopped early, for example on a
+// badly-formed file; the rows processed before that stay stored.
+type ProductImport struct {
+	ID         int64             `json:"id"`
+	Status     string            `json:"status"`
+	Format     string            `json:"format"`
+	Processed  int               `json:"processed_rows"`
+	Created    int               `json:"created_rows"`
+	Updated    int               `json:"updated_rows"`
+	Failed     int               `json:"failed_rows"`
+	RowErrors  []*ImportRowError `json:"row_errors"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// UpsertBySKU creates the products whose external SKU is new and updates the
+// ones it already belongs to. Each product is written under its own savepoint,
+// so one the database rejects does not undo the others; failed maps the index
+// of every rejected product to the reason. With atomic set, any rejection
+// rolls back the whole call instead and nothing is stored.
+//
+// Like Update, an import leaves the stock of existing products alone so it
+// cannot undo concurrent reservations; stock is only set on creation. As with
+// Insert, every created product is issued a seller token, set on the product.
+func (p ProductModel) UpsertBySKU(products []*Product, atomic bool) (int, map[int]error, error) {
+	query := `
+	INSERT INTO products (external_sku, name, description, category, price, currency, average_rating, image_url, seller, stock, seller_token_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	ON CONFLICT (external_sku) DO UPDATE
+	SET name = EXCLUDED.name, description = EXCLUDED.description, category = EXCLUDED.category,
+		price = EXCLUDED.price, currency = EXCLUDED.currency, seller = EXCLUDED.seller
+	WHERE products.deleted_at IS NULL
+	RETURNING id, created_at, xmax = 0
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	created := 0
+	failed := make(map[int]error)
+
+	for i, product := range products {
+		_, err := tx.ExecContext(ctx, `SAVEPOINT import_row`)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		sellerToken, sellerTokenHash, err := generateToken()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var inserted bool
+		args := []any{product.ExternalSKU, product.Name, product.Description, product.Category, product.Price.Amount, product.Price.Currency, 0, product.ImageURL, product.Seller, product.Stock, sellerTokenHash}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&product.ID, &product.CreatedAt, &inserted)
+		if err == nil {
+			err = saveImportedProduct(ctx, tx, product)
+		}
+
+		var pqErr *pq.Error
+		switch {
+		case err == nil:
+			if inserted {
+				product.SellerToken = sellerToken
+				created++
+			}
+		case errors.Is(err, sql.ErrNoRows):
+			failed[i] = ErrProductInTrash
+		case errors.Is(productError(err), ErrUnknownCategory):
+			failed[i] = ErrUnknownCategory
+		case errors.Is(productError(err), ErrCurrencyHasOverrides):
+			failed[i] = ErrCurrencyHasOverrides
+		case errors.Is(err, ErrTooManyImages):
+			failed[i] = ErrTooManyImages
+		case errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23"):
+			// Any other constraint or invalid value only fails its own row.
+			failed[i] = fmt.Errorf("%w: %s", ErrProductRejected, pqErr.Message)
+		default:
+			return 0, nil, err
+		}
+
+		if failed[i] != nil {
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`)
+		} else {
+			_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if atomic && len(failed) > 0 {
+		return 0, failed, nil
+	}
+
+	return created, failed, tx.Commit()
+}
+
+// saveImportedProduct writes what Insert and Update write alongside the
+// products row.
+func saveImportedProduct(ctx context.Context, tx *sql.Tx, product *Product) error {
+	err := saveProductTags(ctx, tx, product.ID, product.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = recordPriceChange(ctx, tx, product)
+	if err != nil {
+		return err
+	}
+
+	if product.Tags == nil {
+		product.Tags = []string{}
+	}
+
+	return setPrimaryImageURL(ctx, tx, product.ID, product.ImageURL)
+}
+
+func ValidateExternalSKU(v *validator.Validator, sku string) {
+	v.Check(sku != "", "external_sku", "must be provided")
+	v.Check(len(sku) <= 100, "external_sku", "must not be more than 100 bytes long")
+}
+
+type ProductImportModel struct {
+	DB *sql.DB
+}
+
+const productImportColumns = `id, status, format, processed_rows, created_rows, updated_rows, failed_rows, row_errors, error, created_at, updated_at, finished_at`
+
+// scanProductImport reads a row selected with productImportColumns.
+func scanProductImport(row rowScanner) (*ProductImport, error) {
+	var productImport ProductImport
+	var rowErrors []byte
+
+	err := row.Scan(&productImport.ID, &productImport.Status, &productImport.Format, &productImport.Processed, &productImport.Created,
+		&productImport.Updated, &productImport.Failed, &rowErrors, &productImport.Error, &productImport.CreatedAt, &productImport.UpdatedAt, &productImport.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(rowErrors, &productImport.RowErrors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &productImport, nil
+}
+
+// Insert records a new import as running.
+func (m ProductImportModel) Insert(productImport *ProductImport) error {
+	query := `
+	INSERT INTO product_imports (format)
+	VALUES ($1)
+	RETURNING ` + productImportColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stored, err := scanProductImport(m.DB.QueryRowContext(ctx, query, productImport.Format))
+	if err != nil {
+		return err
+	}
+
+	*productImport = *stored
+	return nil
+}
+
+func (m ProductImportModel) Get(id int64) (*ProductImport, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + productImportColumns + `
+	FROM product_imports
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	productImport, err := scanProductImport(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return productImport, nil
+}
+
+// FailRunning marks every import still running as failed with message and
+// reports how many there were. It is meant for startup, when no import can
+// still be running, to close those a previous process left behind.
+func (m ProductImportModel) FailRunning(message string) (int64, error) {
+	query := `
+	UPDATE product_imports
+	SET status = 'failed', error = $1, updated_at = NOW(), finished_at = NOW()
+	WHERE status = 'running'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, message)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// Update saves the progress of an import. It is marked finished once its
+// status is no longer running.
+func (m ProductImportModel) Update(productImport *ProductImport) error {
+	query := `
+	UPDATE product_imports
+	SET status = $1, processed_rows = $2, created_rows = $3, updated_rows = $4, failed_rows = $5,
+		row_errors = $6, error = $7, updated_at = NOW(),
+		finished_at = CASE WHEN $1 = 'running' THEN NULL ELSE NOW() END
+	WHERE id = $8
+	RETURNING updated_at, finished_at
+	`
+
+	rowErrors := productImport.RowErrors
+	if rowErrors == nil {
+		rowErrors = []*ImportRowError{}
+	}
+
+	encoded, err := json.Marshal(rowErrors)
+	if err != nil {
+		return err
+	}
+
+	args := []any{productImport.Status, productImport.Processed, productImport.Created, productImport.Updated, productImport.Failed,
+		string(encoded), productImport.Error, productImport.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&productImport.UpdatedAt, &productImport.FinishedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpsertBySKURejectsRowsNotImports(t *testing.T) {
+	db := newTestDB(t)
+	insertTestProduct(t, db, "Kettle")
+
+	_, err := db.Exec(`ALTER TABLE products ADD CONSTRAINT products_test_name_check CHECK (name <> 'Rejected')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	products := []*Product{
+		{ExternalSKU: "SKU-1", Name: "Rejected", Description: "d", Category: "test", Price: Money{Amount: 100, Currency: "USD"}},
+		{ExternalSKU: "SKU-2", Name: "Accepted", Description: "d", Category: "test", Price: Money{Amount: 100, Currency: "USD"}},
+	}
+
+	created, failed, err := ProductModel{DB: db}.UpsertBySKU(products, false)
+	if err != nil {
+		t.Fatalf("got %v; want the violation reported for its row only", err)
+	}
+	if !errors.Is(failed[0], ErrProductRejected) {
+		t.Errorf("got %v for the rejected row; want ErrProductRejected", failed[0])
+	}
+	if created != 1 || failed[1] != nil {
+		t.Errorf("got %d created and %v for the second row; want it stored", created, failed[1])
+	}
+}
+
+func TestUpsertBySKUIssuesSellerTokens(t *testing.T) {
+	db := newTestDB(t)
+	model := ProductModel{DB: db}
+
+	product := &Product{ExternalSKU: "SKU-1", Name: "Kettle", Description: "d", Category: "test", Price: Money{Amount: 100, Currency: "USD"}}
+
+	_, _, err := model.UpsertBySKU([]*Product{product}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.SellerToken == "" {
+		t.Fatal("got no seller token for a created product")
+	}
+
+	matches, err := model.SellerTokenMatches(product.ID, product.SellerToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Error("got the issued seller token refused")
+	}
+
+	again := &Product{ExternalSKU: "SKU-1", Name: "Kettle", Description: "d2", Category: "test", Price: Money{Amount: 100, Currency: "USD"}}
+
+	_, _, err = model.UpsertBySKU([]*Product{again}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.SellerToken != "" {
+		t.Error("got a seller token for an updated product; want its original token kept")
+	}
+
+	matches, err = model.SellerTokenMatches(product.ID, product.SellerToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matches {
+		t.Error("got the original seller token refused after an update")
+	}
+}
@@ -0,0 +1,282 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var ErrDuplicateSKU = errors.New("duplicate sku")
+
+// ProductVariant is one purchasable version of a product, such as a size and
+// colour combination. Reviews stay on the parent product and may name the
+// variant they are about. A nil PriceOverride means the variant sells at the
+// product's price; an override is always in the product's currency.
+type ProductVariant struct {
+	ID                     int64             `json:"id"`
+	ProductID              int64             `json:"product_id"`
+	SKU                    string            `json:"sku"`
+	Options                map[string]string `json:"options"`
+	PriceOverride          *Money            `json:"price_override"`
+	ConvertedPriceOverride *ConvertedPrice   `json:"converted_price_override,omitempty"`
+	Stock                  int32             `json:"stock"`
+	CreatedAt              time.Time         `json:"created_at"`
+	UpdatedAt              time.Time         `json:"updated_at"`
+}
+
+const variantColumns = `v.id, v.product_id, v.sku, v.options, v.price_override, p.currency, v.stock, v.created_at, v.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// queryer is what the attach helpers need to run their query, so that they
+// work on a *sql.DB or inside a *sql.Tx alike.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// scanVariant reads a row selected with variantColumns.
+func scanVariant(row rowScanner) (*ProductVariant, error) {
+	var variant ProductVariant
+	var options []byte
+	var priceOverride sql.NullInt64
+	var currency string
+
+	err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &options, &priceOverride, &currency, &variant.Stock, &variant.CreatedAt, &variant.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(options, &variant.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if priceOverride.Valid {
+		variant.PriceOverride = &Money{Amount: priceOverride.Int64, Currency: currency}
+	}
+
+	return &variant, nil
+}
+
+// variantArgs returns the options and price override in the form the
+// product_variants columns take.
+func variantArgs(variant *ProductVariant) (string, *int64, error) {
+	options := variant.Options
+	if options == nil {
+		options = map[string]string{}
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var priceOverride *int64
+	if variant.PriceOverride != nil {
+		priceOverride = &variant.PriceOverride.Amount
+	}
+
+	return string(encoded), priceOverride, nil
+}
+
+type ProductVariantModel struct {
+	DB *sql.DB
+}
+
+func (m ProductVariantModel) Insert(variant *ProductVariant) error {
+	query := `
+	INSERT INTO product_variants (product_id, sku, options, price_override, stock)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, updated_at
+	`
+
+	options, priceOverride, err := variantArgs(variant)
+	if err != nil {
+		return err
+	}
+	args := []any{variant.ProductID, variant.SKU, options, priceOverride, variant.Stock}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&variant.ID, &variant.CreatedAt, &variant.UpdatedAt)
+	if err != nil {
+		return variantError(err)
+	}
+
+	if variant.Options == nil {
+		variant.Options = map[string]string{}
+	}
+
+	return nil
+}
+
+func (m ProductVariantModel) Get(productID int64, id int64) (*ProductVariant, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + variantColumns + `
+	FROM product_variants v
+	JOIN products p ON p.id = v.product_id
+	WHERE v.id = $1 AND v.product_id = $2 AND p.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	variant, err := scanVariant(m.DB.QueryRowContext(ctx, query, id, productID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return variant, nil
+}
+
+// GetAll lists the variants of a product in the order they were added.
+func (m ProductVariantModel) GetAll(productID int64) ([]*ProductVariant, error) {
+	query := `
+	SELECT ` + variantColumns + `
+	FROM product_variants v
+	JOIN products p ON p.id = v.product_id
+	WHERE v.product_id = $1 AND p.deleted_at IS NULL
+	ORDER BY v.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []*ProductVariant{}
+
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+func (m ProductVariantModel) Update(variant *ProductVariant) error {
+	query := `
+	UPDATE product_variants
+	SET sku = $1, options = $2, price_override = $3, updated_at = NOW()
+	WHERE id = $4 AND product_id = $5
+	RETURNING stock, updated_at
+	`
+
+	options, priceOverride, err := variantArgs(variant)
+	if err != nil {
+		return err
+	}
+	args := []any{variant.SKU, options, priceOverride, variant.ID, variant.ProductID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&variant.Stock, &variant.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return variantError(err)
+	}
+
+	return nil
+}
+
+// SetStock replaces the stock count of a variant. Like products, variants
+// only change stock through here and through reservations, and stock counts
+// the units pending reservations hold the same way as ProductModel.SetStock.
+func (m ProductVariantModel) SetStock(productID int64, id int64, stock int32) (int32, error) {
+	lockQuery := `SELECT id FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE`
+	heldQuery := `
+	SELECT COALESCE(SUM(quantity), 0)
+	FROM reservations
+	WHERE variant_id = $1 AND status = 'pending'
+	`
+	updateQuery := `UPDATE product_variants SET stock = $2, updated_at = NOW() WHERE id = $1`
+
+	return setStock(m.DB, stock, lockQuery, heldQuery, updateQuery, id, productID)
+}
+
+func (m ProductVariantModel) Delete(productID int64, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM product_variants
+	WHERE id = $1 AND product_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, productID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func variantError(err error) error {
+	switch {
+	case violates(err, uniqueViolation, "product_variants_sku_key"):
+		return ErrDuplicateSKU
+	default:
+		return err
+	}
+}
+
+func ValidateProductVariant(v *validator.Validator, variant *ProductVariant, product *Product) {
+	v.Check(variant.SKU != "", "sku", "must be provided")
+	v.Check(len(variant.SKU) <= 100, "sku", "must not be more than 100 bytes long")
+	v.Check(len(variant.Options) <= 10, "options", "must not contain more than 10 options")
+	for name, value := range variant.Options {
+		key := fmt.Sprintf("options.%s", name)
+		v.Check(name != "" && len(name) <= 50, "options", "names must be between 1 and 50 bytes long")
+		v.Check(value != "", key, "must be provided")
+		v.Check(len(value) <= 100, key, "must not be more than 100 bytes long")
+	}
+	if variant.PriceOverride != nil {
+		ValidateMoney(v, "price_override", *variant.PriceOverride)
+		v.Check(variant.PriceOverride.Currency == product.Price.Currency, "price_override", "currency must match the product's currency")
+	}
+	ValidateStock(v, variant.Stock)
+}
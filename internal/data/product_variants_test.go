@@ -0,0 +1,46 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProductCurrencyChangeWithOverrides(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	products := ProductModel{DB: db}
+
+	variant := &ProductVariant{
+		ProductID:     product.ID,
+		SKU:           "KETTLE-RED",
+		PriceOverride: &Money{Amount: 1200, Currency: "USD"},
+	}
+	err := ProductVariantModel{DB: db}.Insert(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product.Price = Money{Amount: 900, Currency: "EUR"}
+	err = products.Update(product)
+	if !errors.Is(err, ErrCurrencyHasOverrides) {
+		t.Fatalf("got %v; want ErrCurrencyHasOverrides", err)
+	}
+
+	product.Price = Money{Amount: 1100, Currency: "USD"}
+	err = products.Update(product)
+	if err != nil {
+		t.Fatalf("got %v changing only the amount; want no error", err)
+	}
+
+	variant.PriceOverride = nil
+	err = ProductVariantModel{DB: db}.Update(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product.Price = Money{Amount: 900, Currency: "EUR"}
+	err = products.Update(product)
+	if err != nil {
+		t.Errorf("got %v once no override is left; want no error", err)
+	}
+}
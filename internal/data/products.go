@@ -8,39 +8,201 @@ import (
 	"log"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/thats-insane/awt-test1/internal/validator"
 )
 
-var ErrRecordNotFound = errors.New("record not found")
+var (
+	ErrRecordNotFound       = errors.New("record not found")
+	ErrCurrencyHasOverrides = errors.New("currency has variant price overrides")
+)
 
 type Product struct {
-	ID            int64     `json:"id"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Category      string    `json:"category"`
-	Price         float64   `json:"price"`
-	AverageRating float64   `json:"average_rating"`
-	ImageURL      string    `json:"image_url"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID             int64              `json:"id"`
+	Name           string             `json:"name"`
+	Description    string             `json:"description"`
+	Category       string             `json:"category"`
+	Price          Money              `json:"price"`
+	ConvertedPrice *ConvertedPrice    `json:"converted_price,omitempty"`
+	AverageRating  float64            `json:"average_rating"`
+	AspectAverages map[string]float64 `json:"aspect_averages,omitempty"`
+	ImageURL       string             `json:"image_url"`
+	Seller         string             `json:"seller"`
+	Stock          int32              `json:"stock"`
+	ExternalSKU    string             `json:"external_sku,omitempty"`
+	SellerToken    string             `json:"seller_token,omitempty"`
+	Tags           []string           `json:"tags"`
+	Variants       []*ProductVariant  `json:"variants,omitempty"`
+	Images         []*ProductImage    `json:"images,omitempty"`
+	Highlights     map[string]string  `json:"highlights,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	DeletedAt      *time.Time         `json:"deleted_at,omitempty"`
+}
+
+// ProductFilter holds the list filters shared by GetAll and Facets. The
+// category filter is a slug and also matches products in any of that
+// category's descendants. Price matches products priced at exactly that
+// amount in that currency. PriceDroppedSince matches products that are
+// cheaper now than they were at that time. InStock counts a product as in
+// stock when it or any of its variants has stock left. Search is a free-text
+// query in websearch syntax matched against the weighted search_vector, or,
+// when Fuzzy is set, matched against product names by trigram similarity.
+type ProductFilter struct {
+	Name              string
+	Description       string
+	Category          string
+	Price             *Money
+	AverageRating     string
+	ImageURL          string
+	Tag               string
+	PriceDroppedSince *time.Time
+	InStock           *bool
+	Search            string
+	Fuzzy             bool
 }
 
+const productFilterClause = `
+	deleted_at IS NULL
+	AND (to_tsvector('simple', name) @@
+		plainto_tsquery('simple', $1) OR $1 = '')
+	AND (to_tsvector('simple', description) @@
+		plainto_tsquery('simple', $2) OR $2 = '')
+	AND ($3 = '' OR category IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id, slug FROM categories WHERE slug = $3
+			UNION ALL
+			SELECT c.id, c.slug FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT slug FROM subtree))
+	AND ($4::bigint IS NULL OR (price = $4 AND currency = $13))
+	AND (to_tsvector('simple', average_rating::text) @@
+		plainto_tsquery('simple', $5) OR $5 = '')
+	AND (to_tsvector('simple', image_url) @@
+		plainto_tsquery('simple', $6) OR $6 = '')
+	AND ($7 = '' OR id IN (
+		SELECT pt.product_id
+		FROM product_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE t.slug = $7))
+	AND ($8::timestamptz IS NULL OR price < (
+		SELECT ph.price
+		FROM price_history ph
+		WHERE ph.product_id = products.id
+			AND ph.currency = products.currency
+			AND ph.effective_at <= $8
+		ORDER BY ph.effective_at DESC, ph.id DESC
+		LIMIT 1))
+	AND ($9::boolean IS NULL OR $9 = (stock > 0 OR EXISTS (
+		SELECT 1
+		FROM product_variants pv
+		WHERE pv.product_id = products.id AND pv.stock > 0)))
+	AND ($10 = ''
+		OR (NOT $12::boolean AND search_vector @@ ` + searchQuery + `)
+		OR ($12 AND $10 <% name))`
+
+// args returns the parameters of productFilterClause, searching with the
+// given text search configuration.
+func (f ProductFilter) args(language string) []any {
+	var price *int64
+	var currency string
+	if f.Price != nil {
+		price = &f.Price.Amount
+		currency = f.Price.Currency
+	}
+
+	return []any{f.Name, f.Description, f.Category, price, f.AverageRating, f.ImageURL, f.Tag, f.PriceDroppedSince, f.InStock, f.Search, language, f.Fuzzy, currency}
+}
+
+// ProductModel reads and writes products. SearchLanguage is the text search
+// configuration product searches are parsed with, the same one the
+// SearchModel keeps the stored vectors in.
 type ProductModel struct {
-	DB *sql.DB
+	DB             *sql.DB
+	SearchLanguage string
 }
 
 func (p ProductModel) Insert(product *Product) error {
 	query := `
-	INSERT INTO products (name, description, category, price, average_rating, image_url) 
-	VALUES ($1, $2, $3, $4, $5, $6) 
+	INSERT INTO products (name, description, category, price, currency, average_rating, image_url, seller, stock, seller_token_hash) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) 
 	RETURNING id, created_at
 	`
 
-	args := []any{product.Name, product.Description, product.Category, product.Price, 0, product.ImageURL}
+	sellerToken, sellerTokenHash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	args := []any{product.Name, product.Description, product.Category, product.Price.Amount, product.Price.Currency, 0, product.ImageURL, product.Seller, product.Stock, sellerTokenHash}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&product.ID, &product.CreatedAt)
+	if err != nil {
+		return productError(err)
+	}
+
+	err = saveProductTags(ctx, tx, product.ID, product.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = recordPriceChange(ctx, tx, product)
+	if err != nil {
+		return err
+	}
+
+	err = setPrimaryImageURL(ctx, tx, product.ID, product.ImageURL)
+	if err != nil {
+		return err
+	}
+
+	if product.Tags == nil {
+		product.Tags = []string{}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	product.SellerToken = sellerToken
+	return nil
+}
+
+// SellerTokenMatches reports whether token is the seller token issued when
+// the product was created.
+func (p ProductModel) SellerTokenMatches(id int64, token string) (bool, error) {
+	if id < 1 || token == "" {
+		return false, nil
+	}
+
+	query := `
+	SELECT COALESCE(seller_token_hash = $2, false)
+	FROM products
+	WHERE id = $1 AND deleted_at IS NULL
+	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(&product.ID, &product.CreatedAt)
+	var matches bool
+	err := p.DB.QueryRowContext(ctx, query, id, tokenHash(token)).Scan(&matches)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return matches, nil
 }
 
 func (p ProductModel) Get(id int64) (*Product, error) {
@@ -49,9 +211,9 @@ func (p ProductModel) Get(id int64) (*Product, error) {
 	}
 
 	query := `
-	SELECT id, name, description, category, price, average_rating, image_url, created_at
+	SELECT id, name, description, category, price, currency, average_rating, image_url, seller, stock, COALESCE(external_sku, ''), created_at
 	FROM products
-	WHERE id = $1;
+	WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	var product Product
@@ -59,7 +221,7 @@ func (p ProductModel) Get(id int64) (*Product, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := p.DB.QueryRowContext(ctx, query, id).Scan(&product.ID, &product.Name, &product.Description, &product.Category, &product.Price, &product.AverageRating, &product.ImageURL, &product.CreatedAt)
+	err := p.DB.QueryRowContext(ctx, query, id).Scan(&product.ID, &product.Name, &product.Description, &product.Category, &product.Price.Amount, &product.Price.Currency, &product.AverageRating, &product.ImageURL, &product.Seller, &product.Stock, &product.ExternalSKU, &product.CreatedAt)
 
 	if err != nil {
 		switch {
@@ -69,33 +231,83 @@ func (p ProductModel) Get(id int64) (*Product, error) {
 			return nil, err
 		}
 	}
+
+	err = attachAspectAverages(ctx, p.DB, []*Product{&product})
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachTags(ctx, p.DB, []*Product{&product})
+	if err != nil {
+		return nil, err
+	}
+
 	return &product, nil
 }
 
-func (p ProductModel) GetAll(name string, description string, category string, price string, avgRating string, imageURL string, filters Filters) ([]*Product, Metadata, error) {
+// GetAll lists the products matching the filter. A search that finds nothing
+// is retried as a fuzzy search, which the metadata reports along with
+// suggested spellings.
+func (p ProductModel) GetAll(filter ProductFilter, filters Filters) ([]*Product, Metadata, error) {
+	products, metadata, err := p.getAll(filter, filters)
+	if err != nil || filter.Search == "" || filter.Fuzzy || metadata.TotalRecords > 0 {
+		return products, metadata, err
+	}
+
+	// An empty page past the first one may just be past the last match.
+	if filters.Page > 1 {
+		matched, err := p.anyMatch(filter)
+		if err != nil || matched {
+			return products, metadata, err
+		}
+	}
+
+	filter.Fuzzy = true
+	products, metadata, err = p.getAll(filter, filters)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata.Fuzzy = true
+
+	metadata.DidYouMean, err = p.didYouMean(filter.Search)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return products, metadata, nil
+}
+
+// anyMatch reports whether any product matches the filter.
+func (p ProductModel) anyMatch(filter ProductFilter) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM products WHERE ` + productFilterClause + `)`
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.DB.QueryRowContext(ctx, query, filter.args(p.SearchLanguage)...).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (p ProductModel) getAll(filter ProductFilter, filters Filters) ([]*Product, Metadata, error) {
 	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, name, description, category, price, average_rating, image_url, created_at
+	SELECT COUNT(*) OVER(), id, name, description, category, price, currency, average_rating, image_url, seller, stock, COALESCE(external_sku, ''), created_at
 	FROM products
-	WHERE (to_tsvector('simple', name) @@
-		plainto_tsquery('simple', $1) OR $1 = '')
-    AND (to_tsvector('simple', description) @@
-		plainto_tsquery('simple', $2) OR $2 = '')
-	AND (to_tsvector('simple', category) @@
-		plainto_tsquery('simple', $3) OR $3 = '')
-	AND (to_tsvector('simple', price) @@
-		plainto_tsquery('simple', $4) OR $4 = '')
-	AND (to_tsvector('simple', average_rating) @@
-		plainto_tsquery('simple', $5) OR $5 = '')
-	AND (to_tsvector('simple', image_url) @@
-		plainto_tsquery('simple', $6) OR $6 = '')
-	ORDER BY %s %s, id ASC 
-        LIMIT $7 OFFSET $8
-	`, filters.sortColumn(), filters.sortDirection())
+	WHERE %s
+	ORDER BY %s, id ASC 
+        LIMIT $14 OFFSET $15
+	`, productFilterClause, productOrderBy(filter, filters))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := p.DB.QueryContext(ctx, query, name, description, category, price, avgRating, imageURL, filters.limit(), filters.offset())
+	args := append(filter.args(p.SearchLanguage), filters.limit(), filters.offset())
+
+	rows, err := p.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -106,7 +318,7 @@ func (p ProductModel) GetAll(name string, description string, category string, p
 
 	for rows.Next() {
 		var product Product
-		err := rows.Scan(&totalRecords, &product.ID, &product.Name, &product.Description, &product.Category, &product.Price, &product.AverageRating, &product.ImageURL, &product.CreatedAt)
+		err := rows.Scan(&totalRecords, &product.ID, &product.Name, &product.Description, &product.Category, &product.Price.Amount, &product.Price.Currency, &product.AverageRating, &product.ImageURL, &product.Seller, &product.Stock, &product.ExternalSKU, &product.CreatedAt)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -119,6 +331,23 @@ func (p ProductModel) GetAll(name string, description string, category string, p
 		return nil, Metadata{}, err
 	}
 
+	err = attachAspectAverages(ctx, p.DB, products)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachTags(ctx, p.DB, products)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if !filter.Fuzzy {
+		err = attachHighlights(ctx, p.DB, products, filter.Search, p.SearchLanguage)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 
 	return products, metadata, nil
@@ -128,31 +357,127 @@ func (p ProductModel) Update(product *Product) error {
 
 	query := `
 	UPDATE products 
-	SET name = $1, description = $2, category = $3, price = $4, image_url = $5, average_rating = $6 
-	WHERE id = $7
+	SET name = $1, description = $2, category = $3, price = $4, currency = $5, average_rating = $6, seller = $7 
+	WHERE id = $8 AND deleted_at IS NULL
 	RETURNING id
 	`
 
-	args := []any{product.Name, product.Description, product.Category, product.Price, product.ImageURL, product.AverageRating, product.ID}
+	args := []any{product.Name, product.Description, product.Category, product.Price.Amount, product.Price.Currency, product.AverageRating, product.Seller, product.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := p.DB.QueryRowContext(ctx, query, args...).Scan(&product.ID)
+	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&product.ID)
+	if err != nil {
+		return productError(err)
+	}
 
-	return p.DB.QueryRowContext(ctx, query, args...).Scan(&product.ID)
+	err = saveProductTags(ctx, tx, product.ID, product.Tags)
+	if err != nil {
+		return err
+	}
+
+	err = recordPriceChange(ctx, tx, product)
+	if err != nil {
+		return err
+	}
+
+	err = setPrimaryImageURL(ctx, tx, product.ID, product.ImageURL)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// SetStock replaces the stock count of a product. Update leaves stock alone
+// so that editing a product cannot undo concurrent reservations. stock is the
+// count on hand, including units held by pending reservations; since those
+// were taken out of stock when they were made and go back in when released,
+// the stored count is stock less what they hold. It returns that count.
+func (p ProductModel) SetStock(id int64, stock int32) (int32, error) {
+	lockQuery := `SELECT id FROM products WHERE id = $1 FOR UPDATE`
+	heldQuery := `
+	SELECT COALESCE(SUM(quantity), 0)
+	FROM reservations
+	WHERE product_id = $1 AND variant_id IS NULL AND status = 'pending'
+	`
+	updateQuery := `UPDATE products SET stock = $2 WHERE id = $1`
+
+	return setStock(p.DB, stock, lockQuery, heldQuery, updateQuery, id)
+}
+
+func productError(err error) error {
+	switch {
+	case violates(err, foreignKeyViolation, "products_category_fkey"):
+		return ErrUnknownCategory
+	case raised(err, currencyHasOverrides):
+		return ErrCurrencyHasOverrides
+	default:
+		return err
+	}
+}
+
+// Delete moves the product to the trash. It stays restorable until the purge
+// job removes it for good. Pending reservations of the product and its
+// variants are released, since they can no longer be confirmed.
 func (p ProductModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-	DELETE FROM products
-	WHERE id = $1
+	UPDATE products
+	SET deleted_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, closeReservations("released", "product_id = $1"), id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore takes a product back out of the trash.
+func (p ProductModel) Restore(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE products
+	SET deleted_at = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -175,10 +500,98 @@ func (p ProductModel) Delete(id int64) error {
 	return nil
 }
 
+// GetDeleted lists the products in the trash.
+func (p ProductModel) GetDeleted(filters Filters) ([]*Product, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), id, name, description, category, price, currency, average_rating, image_url, seller, stock, COALESCE(external_sku, ''), created_at, deleted_at
+	FROM products
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $1 OFFSET $2
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	products := []*Product{}
+
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(&totalRecords, &product.ID, &product.Name, &product.Description, &product.Category, &product.Price.Amount, &product.Price.Currency, &product.AverageRating, &product.ImageURL, &product.Seller, &product.Stock, &product.ExternalSKU, &product.CreatedAt, &product.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		products = append(products, &product)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachTags(ctx, p.DB, products)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return products, metadata, nil
+}
+
+// Purge permanently removes products that have been in the trash for longer
+// than retention, along with their reviews. Products that appear in orders
+// are kept so that order history stays intact. It returns how many products
+// were removed. The storage keys of their images are queued in
+// orphaned_objects by the delete triggers.
+func (p ProductModel) Purge(retention time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT id
+	FROM products p
+	WHERE deleted_at <= NOW() - make_interval(secs => $1)
+		AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = p.id)
+	FOR UPDATE
+	`
+
+	ids, err := queryIDs(ctx, tx, query, retention.Seconds())
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM products WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
+
 func (p ProductModel) Exists(productID int64) (bool, error) {
 	query := `
 	SELECT EXISTS
-	(SELECT 1 FROM products WHERE id = $1)
+	(SELECT 1 FROM products WHERE id = $1 AND deleted_at IS NULL)
 	`
 	var exists bool
 
@@ -193,17 +606,29 @@ func (p ProductModel) Exists(productID int64) (bool, error) {
 func ValidateProduct(v *validator.Validator, product *Product, handler int) {
 	switch handler {
 	case 1:
-		v.Check(product.Name != "", "name", "must be provided")
-		v.Check(product.Description != "", "description", "must be provided")
-		v.Check(product.Category != "", "category", "must be provided")
 		v.Check(product.AverageRating != 0, "average_rating", "must be provided")
-		v.Check(product.ImageURL != "", "image_url", "must be provided")
-
-		v.Check(len(product.Name) <= 100, "name", "must not be more than 100 byte long")
-		v.Check(len(product.Description) <= 100, "description", "must not be more than 100 byte long")
-		v.Check(len(product.Category) <= 100, "category", "must not be more than 100 byte long")
+		validateProductFields(v, product)
 	default:
 		log.Printf("Unable to locate handler ID: %d", handler)
 		v.AddError("default", "Handler ID not provided")
 	}
 }
+
+// ValidateImportedProduct checks a product of a bulk import. It is
+// ValidateProduct without the average rating, which an import does not set.
+func ValidateImportedProduct(v *validator.Validator, product *Product) {
+	validateProductFields(v, product)
+}
+
+func validateProductFields(v *validator.Validator, product *Product) {
+	v.Check(product.Name != "", "name", "must be provided")
+	v.Check(product.Description != "", "description", "must be provided")
+	v.Check(product.Category != "", "category", "must be provided")
+	ValidateMoney(v, "price", product.Price)
+
+	v.Check(len(product.Name) <= 100, "name", "must not be more than 100 byte long")
+	v.Check(len(product.Description) <= 100, "description", "must not be more than 100 byte long")
+	v.Check(len(product.Category) <= 100, "category", "must not be more than 100 byte long")
+	v.Check(len(product.Seller) <= 100, "seller", "must not be more than 100 byte long")
+	ValidateStock(v, product.Stock)
+}
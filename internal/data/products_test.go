@@ -0,0 +1,73 @@
+package data
+
+import "testing"
+
+func TestSellerTokenMatches(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	other := insertTestProduct(t, db, "Toaster")
+	products := ProductModel{DB: db}
+
+	if product.SellerToken == "" {
+		t.Fatal("Insert did not issue a seller token")
+	}
+
+	tests := []struct {
+		name  string
+		id    int64
+		token string
+		want  bool
+	}{
+		{"own token", product.ID, product.SellerToken, true},
+		{"no token", product.ID, "", false},
+		{"another product's token", product.ID, other.SellerToken, false},
+		{"missing product", other.ID + 1, product.SellerToken, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := products.SellerTokenMatches(tt.id, tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if matches != tt.want {
+				t.Errorf("got %t; want %t", matches, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductPriceFilter(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	insertTestProduct(t, db, "Toaster")
+
+	_, err := db.Exec(`UPDATE products SET price = 1999 WHERE id = $1`, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		price Money
+		want  int
+	}{
+		{"matching amount", Money{1999, "USD"}, 1},
+		{"other amount", Money{1998, "USD"}, 0},
+		{"same amount in another currency", Money{1999, "EUR"}, 0},
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			products, _, err := ProductModel{DB: db, SearchLanguage: "english"}.GetAll(ProductFilter{Price: &tt.price}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(products) != tt.want {
+				t.Errorf("got %d products; want %d", len(products), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+type Question struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"product_id"`
+	Author      string    `json:"author"`
+	Body        string    `json:"body"`
+	AnswerCount int64     `json:"answer_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const questionColumns = `id, product_id, author, body,
+	(SELECT COUNT(*) FROM answers WHERE answers.question_id = questions.id) AS answer_count,
+	created_at, updated_at`
+
+func (question *Question) fields() []any {
+	return []any{&question.ID, &question.ProductID, &question.Author, &question.Body, &question.AnswerCount,
+		&question.CreatedAt, &question.UpdatedAt}
+}
+
+type QuestionModel struct {
+	DB *sql.DB
+}
+
+func (q QuestionModel) Insert(question *Question) error {
+	query := `
+	INSERT INTO questions (product_id, author, body)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, updated_at
+	`
+	args := []any{question.ProductID, question.Author, question.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return q.DB.QueryRowContext(ctx, query, args...).Scan(&question.ID, &question.CreatedAt, &question.UpdatedAt)
+}
+
+// Get returns the question only if it belongs to the product.
+func (q QuestionModel) Get(productID int64, id int64) (*Question, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + questionColumns + `
+	FROM questions
+	WHERE id = $1 AND product_id = $2
+	`
+	var question Question
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := q.DB.QueryRowContext(ctx, query, id, productID).Scan(question.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &question, nil
+}
+
+func (q QuestionModel) GetAll(productID int64, body string, filters Filters) ([]*Question, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), %s
+	FROM questions
+	WHERE product_id = $1
+	AND (to_tsvector('simple', body) @@
+		plainto_tsquery('simple', $2) OR $2 = '')
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4`, questionColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := q.DB.QueryContext(ctx, query, productID, body, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	questions := []*Question{}
+
+	for rows.Next() {
+		var question Question
+		err := rows.Scan(append([]any{&totalRecords}, question.fields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		questions = append(questions, &question)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return questions, metadata, nil
+}
+
+func (q QuestionModel) Update(question *Question) error {
+	query := `
+	UPDATE questions
+	SET body = $1, updated_at = NOW()
+	WHERE id = $2
+	RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return q.DB.QueryRowContext(ctx, query, question.Body, question.ID).Scan(&question.UpdatedAt)
+}
+
+func (q QuestionModel) Delete(productID int64, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM questions
+	WHERE id = $1 AND product_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := q.DB.ExecContext(ctx, query, id, productID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateQuestion(v *validator.Validator, question *Question) {
+	v.Check(question.Author != "", "author", "must be provided")
+	v.Check(len(question.Author) <= 25, "author", "must not be more than 25 bytes long")
+	v.Check(question.Body != "", "body", "must be provided")
+	v.Check(len(question.Body) <= 1000, "body", "must not be more than 1000 bytes long")
+}
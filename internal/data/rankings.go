@@ -0,0 +1,167 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// The rankings kept in product_rankings.
+const (
+	RankingTrending = "trending"
+	RankingTopRated = "top-rated"
+)
+
+func ValidRanking(ranking string) bool {
+	return ranking == RankingTrending || ranking == RankingTopRated
+}
+
+const (
+	// trendingHalfLife is how long it takes a review's contribution to the
+	// trending score to halve.
+	trendingHalfLife = 3 * 24 * time.Hour
+
+	// trendingWindow is how far back reviews count towards trending at all.
+	trendingWindow = 14 * 24 * time.Hour
+)
+
+// RankedProduct is a product's place in a ranking. ReviewCount is the number
+// of reviews the score was computed from: those in the trending window, or
+// all of them for top-rated.
+type RankedProduct struct {
+	Rank        int       `json:"rank"`
+	Product     *Product  `json:"product"`
+	Score       float64   `json:"score"`
+	ReviewCount int       `json:"review_count"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
+type RankingModel struct {
+	DB *sql.DB
+}
+
+// Recompute materialises both rankings and reports how many rows were stored.
+//
+// Trending sums every recent review, weighted by its rating out of five and
+// decayed exponentially with its age, so steady recent attention beats one
+// old burst. Top-rated is the Bayesian average used for review stats: every
+// product starts with bayesianPriorWeight reviews at the site-wide mean, so a
+// single 5-star review cannot put a product on top.
+func (m RankingModel) Recompute() (int64, error) {
+	query := `
+	WITH live_reviews AS (
+		SELECT r.product_id, r.rating, r.created_at
+		FROM reviews r
+		JOIN products p ON p.id = r.product_id
+		WHERE r.deleted_at IS NULL AND p.deleted_at IS NULL
+	), site AS (
+		SELECT COALESCE(AVG(rating), 0)::double precision AS mean
+		FROM live_reviews
+	)
+	INSERT INTO product_rankings (ranking, product_id, score, review_count)
+	SELECT $1::text, product_id,
+		SUM(rating / 5.0 * power(0.5, EXTRACT(EPOCH FROM NOW() - created_at) / $4::double precision))::double precision,
+		COUNT(*)
+	FROM live_reviews
+	WHERE created_at > NOW() - make_interval(secs => $5)
+	GROUP BY product_id
+	UNION ALL
+	SELECT $2::text, product_id,
+		(($3::integer * site.mean + SUM(rating)) / ($3::integer + COUNT(*)))::double precision,
+		COUNT(*)
+	FROM live_reviews, site
+	GROUP BY product_id, site.mean
+	`
+	args := []any{RankingTrending, RankingTopRated, bayesianPriorWeight, trendingHalfLife.Seconds(), trendingWindow.Seconds()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM product_rankings`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return stored, tx.Commit()
+}
+
+// GetAll pages through a ranking, best first. A category slug limits it to
+// that category and its descendants, with ranks counted within the category.
+func (m RankingModel) GetAll(ranking string, category string, filters Filters) ([]*RankedProduct, Metadata, error) {
+	query := `
+	SELECT COUNT(*) OVER(), r.product_id, r.score, r.review_count, r.computed_at
+	FROM product_rankings r
+	JOIN products p ON p.id = r.product_id
+	WHERE r.ranking = $1 AND p.deleted_at IS NULL
+	AND ($2 = '' OR p.category IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id, slug FROM categories WHERE slug = $2
+			UNION ALL
+			SELECT c.id, c.slug FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT slug FROM subtree))
+	ORDER BY r.score DESC, r.product_id
+	LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ranking, category, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	ranked := []*RankedProduct{}
+	byID := make(map[int64]*RankedProduct)
+	ids := []int64{}
+
+	for rows.Next() {
+		var productID int64
+		item := &RankedProduct{Rank: filters.offset() + len(ranked) + 1}
+
+		err := rows.Scan(&totalRecords, &productID, &item.Score, &item.ReviewCount, &item.ComputedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		ranked = append(ranked, item)
+		byID[productID] = item
+		ids = append(ids, productID)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	products, err := getProductsByID(ctx, m.DB, ids)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	for _, product := range products {
+		byID[product.ID].Product = product
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return ranked, metadata, nil
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func insertTestReviews(t *testing.T, db *sql.DB, productID int64, ratings ...int64) {
+	t.Helper()
+
+	for i, rating := range ratings {
+		err := ReviewModel{DB: db}.Insert(&Review{ProductID: productID, Author: fmt.Sprintf("reviewer%d", i), Rating: rating})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func rankingScores(t *testing.T, rankings RankingModel, ranking string) map[int64]float64 {
+	t.Helper()
+
+	ranked, _, err := rankings.GetAll(ranking, "", Filters{Page: 1, PageSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scores := make(map[int64]float64, len(ranked))
+	for _, item := range ranked {
+		scores[item.Product.ID] = item.Score
+	}
+	return scores
+}
+
+func TestRankingScores(t *testing.T) {
+	db := newTestDB(t)
+
+	// One fresh 5-star review, the same review three days (one half-life)
+	// old, twelve 5-star and four 1-star reviews from a month ago, and a
+	// deleted product.
+	fresh := insertTestProduct(t, db, "Fresh")
+	insertTestReviews(t, db, fresh.ID, 5)
+
+	halfLife := insertTestProduct(t, db, "Half life")
+	insertTestReviews(t, db, halfLife.ID, 5)
+
+	established := insertTestProduct(t, db, "Established")
+	insertTestReviews(t, db, established.ID, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5)
+
+	poor := insertTestProduct(t, db, "Poor")
+	insertTestReviews(t, db, poor.ID, 1, 1, 1, 1)
+
+	deleted := insertTestProduct(t, db, "Deleted")
+	insertTestReviews(t, db, deleted.ID, 5)
+
+	_, err := db.Exec(`UPDATE reviews SET created_at = NOW() - interval '3 days' WHERE product_id = $1`, halfLife.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`UPDATE reviews SET created_at = NOW() - interval '30 days' WHERE product_id = ANY($1)`, pq.Array([]int64{established.ID, poor.ID}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ProductModel{DB: db}.Delete(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rankings := RankingModel{DB: db}
+	_, err = rankings.Recompute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trending := rankingScores(t, rankings, RankingTrending)
+	if len(trending) != 2 {
+		t.Fatalf("got trending scores %v; want only the two products reviewed within the window", trending)
+	}
+	if math.Abs(trending[fresh.ID]-1) > 0.01 {
+		t.Errorf("got trending score %v for a fresh 5-star review; want 1", trending[fresh.ID])
+	}
+	if math.Abs(trending[halfLife.ID]-0.5) > 0.01 {
+		t.Errorf("got trending score %v for a review one half-life old; want 0.5", trending[halfLife.ID])
+	}
+
+	// The site-wide mean of the 18 live reviews is 74/18. A product's score
+	// is (10 × mean + sum of ratings) / (10 + count).
+	mean := 74.0 / 18
+	topRated := rankingScores(t, rankings, RankingTopRated)
+	if len(topRated) != 4 {
+		t.Fatalf("got top-rated scores %v; want the four live products", topRated)
+	}
+
+	tests := []struct {
+		name    string
+		product *Product
+		want    float64
+	}{
+		{"one 5-star review", fresh, (10*mean + 5) / 11},
+		{"twelve 5-star reviews", established, (10*mean + 60) / 22},
+		{"four 1-star reviews", poor, (10*mean + 4) / 14},
+	}
+
+	for _, tt := range tests {
+		if math.Abs(topRated[tt.product.ID]-tt.want) > 0.001 {
+			t.Errorf("%s: got top-rated %v; want %v", tt.name, topRated[tt.product.ID], tt.want)
+		}
+	}
+
+	if topRated[established.ID] <= topRated[fresh.ID] {
+		t.Errorf("got top-rated %v for twelve 5-star reviews and %v for one; want the established product ahead", topRated[established.ID], topRated[fresh.ID])
+	}
+}
@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var ErrDuplicateAspect = errors.New("duplicate rating aspect")
+
+// RatingAspect is something reviewers of products in a category can score
+// separately from the overall rating, such as quality or value.
+type RatingAspect struct {
+	ID        int64     `json:"id"`
+	Category  string    `json:"category"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RatingAspectModel struct {
+	DB *sql.DB
+}
+
+func (m RatingAspectModel) Insert(aspect *RatingAspect) error {
+	query := `
+	INSERT INTO rating_aspects (category, name)
+	VALUES ($1, $2)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, aspect.Category, aspect.Name).Scan(&aspect.ID, &aspect.CreatedAt)
+	if err != nil {
+		return ratingAspectError(err)
+	}
+
+	return nil
+}
+
+func (m RatingAspectModel) Get(id int64) (*RatingAspect, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, category, name, created_at
+	FROM rating_aspects
+	WHERE id = $1
+	`
+	var aspect RatingAspect
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&aspect.ID, &aspect.Category, &aspect.Name, &aspect.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &aspect, nil
+}
+
+// GetAll lists the aspects of a category, or of every category when category
+// is empty.
+func (m RatingAspectModel) GetAll(category string) ([]*RatingAspect, error) {
+	query := `
+	SELECT id, category, name, created_at
+	FROM rating_aspects
+	WHERE category = $1 OR $1 = ''
+	ORDER BY category, name
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.query(ctx, query, category)
+}
+
+// GetForProduct lists the aspects declared for the product's category.
+func (m RatingAspectModel) GetForProduct(productID int64) ([]*RatingAspect, error) {
+	query := `
+	SELECT a.id, a.category, a.name, a.created_at
+	FROM rating_aspects a
+	JOIN products p ON p.category = a.category
+	WHERE p.id = $1
+	ORDER BY a.name
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.query(ctx, query, productID)
+}
+
+func (m RatingAspectModel) query(ctx context.Context, query string, args ...any) ([]*RatingAspect, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aspects := []*RatingAspect{}
+
+	for rows.Next() {
+		var aspect RatingAspect
+		err := rows.Scan(&aspect.ID, &aspect.Category, &aspect.Name, &aspect.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		aspects = append(aspects, &aspect)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return aspects, nil
+}
+
+func (m RatingAspectModel) Update(aspect *RatingAspect) error {
+	query := `
+	UPDATE rating_aspects
+	SET category = $1, name = $2
+	WHERE id = $3
+	RETURNING id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, aspect.Category, aspect.Name, aspect.ID).Scan(&aspect.ID)
+	if err != nil {
+		return ratingAspectError(err)
+	}
+
+	return nil
+}
+
+func ratingAspectError(err error) error {
+	switch {
+	case violates(err, uniqueViolation, "rating_aspects_category_name_key"):
+		return ErrDuplicateAspect
+	case violates(err, foreignKeyViolation, "rating_aspects_category_fkey"):
+		return ErrUnknownCategory
+	default:
+		return err
+	}
+}
+
+func (m RatingAspectModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM rating_aspects
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// saveAspectRatings replaces the per-aspect scores of a review. Names that
+// are not aspects of the product's category are ignored; ValidateReview is
+// expected to have rejected them already.
+func saveAspectRatings(ctx context.Context, tx *sql.Tx, reviewID int64, aspects map[string]int64) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM review_aspect_ratings WHERE review_id = $1`, reviewID)
+	if err != nil {
+		return err
+	}
+
+	if len(aspects) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(aspects))
+	ratings := make([]int64, 0, len(aspects))
+	for name, rating := range aspects {
+		names = append(names, name)
+		ratings = append(ratings, rating)
+	}
+
+	query := `
+	INSERT INTO review_aspect_ratings (review_id, aspect_id, rating)
+	SELECT r.id, a.id, scores.rating
+	FROM reviews r
+	JOIN products p ON p.id = r.product_id
+	JOIN rating_aspects a ON a.category = p.category
+	JOIN unnest($2::text[], $3::integer[]) AS scores(name, rating) ON scores.name = a.name
+	WHERE r.id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, reviewID, pq.Array(names), pq.Array(ratings))
+	return err
+}
+
+// attachAspectRatings loads the per-aspect scores for a page of reviews in a
+// single query and embeds them in place.
+func attachAspectRatings(ctx context.Context, db queryer, reviews []*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Review, len(reviews))
+	ids := make([]int64, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	query := `
+	SELECT rar.review_id, a.name, rar.rating
+	FROM review_aspect_ratings rar
+	JOIN rating_aspects a ON a.id = rar.aspect_id
+	WHERE rar.review_id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reviewID, rating int64
+		var name string
+		err := rows.Scan(&reviewID, &name, &rating)
+		if err != nil {
+			return err
+		}
+
+		review := byID[reviewID]
+		if review.Aspects == nil {
+			review.Aspects = make(map[string]int64)
+		}
+		review.Aspects[name] = rating
+	}
+
+	return rows.Err()
+}
+
+// attachAspectAverages loads the mean per-aspect score of each product in a
+// single query and embeds them in place.
+func attachAspectAverages(ctx context.Context, db queryer, products []*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+		ids = append(ids, product.ID)
+	}
+
+	query := `
+	SELECT r.product_id, a.name, AVG(rar.rating)::double precision
+	FROM review_aspect_ratings rar
+	JOIN rating_aspects a ON a.id = rar.aspect_id
+	JOIN reviews r ON r.id = rar.review_id
+	WHERE r.product_id = ANY($1) AND r.deleted_at IS NULL
+	GROUP BY r.product_id, a.name
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int64
+		var name string
+		var average float64
+		err := rows.Scan(&productID, &name, &average)
+		if err != nil {
+			return err
+		}
+
+		product := byID[productID]
+		if product.AspectAverages == nil {
+			product.AspectAverages = make(map[string]float64)
+		}
+		product.AspectAverages[name] = average
+	}
+
+	return rows.Err()
+}
+
+func ValidateRatingAspect(v *validator.Validator, aspect *RatingAspect) {
+	v.Check(aspect.Category != "", "category", "must be provided")
+	v.Check(len(aspect.Category) <= 100, "category", "must not be more than 100 bytes long")
+	v.Check(aspect.Name != "", "name", "must be provided")
+	v.Check(len(aspect.Name) <= 50, "name", "must not be more than 50 bytes long")
+}
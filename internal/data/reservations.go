@@ -0,0 +1,291 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrReservationClosed = errors.New("reservation is no longer pending")
+	ErrStockHeld         = errors.New("stock is held by pending reservations")
+)
+
+// Reservation holds stock of a product, or of one of its variants, for a
+// checkout. The stock is taken when the reservation is made. Confirming keeps
+// it taken; releasing or letting the reservation expire puts it back.
+type Reservation struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	VariantID *int64    `json:"variant_id,omitempty"`
+	Quantity  int32     `json:"quantity"`
+	Status    string    `json:"status"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const reservationColumns = `id, product_id, variant_id, quantity, status, expires_at, created_at, updated_at`
+
+func (reservation *Reservation) fields() []any {
+	return []any{&reservation.ID, &reservation.ProductID, &reservation.VariantID, &reservation.Quantity,
+		&reservation.Status, &reservation.ExpiresAt, &reservation.CreatedAt, &reservation.UpdatedAt}
+}
+
+// closeReservations builds a statement that moves the pending reservations
+// matching condition to status and puts their quantities back into stock,
+// returning the reservations it closed.
+func closeReservations(status string, condition string) string {
+	return `
+	WITH closed AS (
+		UPDATE reservations
+		SET status = '` + status + `', updated_at = NOW()
+		WHERE status = 'pending' AND ` + condition + `
+		RETURNING ` + reservationColumns + `
+	), restocked_variants AS (
+		UPDATE product_variants v
+		SET stock = v.stock + c.quantity
+		FROM (
+			SELECT variant_id, SUM(quantity) AS quantity
+			FROM closed
+			WHERE variant_id IS NOT NULL
+			GROUP BY variant_id
+		) c
+		WHERE v.id = c.variant_id
+	), restocked_products AS (
+		UPDATE products p
+		SET stock = p.stock + c.quantity
+		FROM (
+			SELECT product_id, SUM(quantity) AS quantity
+			FROM closed
+			WHERE variant_id IS NULL
+			GROUP BY product_id
+		) c
+		WHERE p.id = c.product_id
+	)
+	SELECT ` + reservationColumns + `
+	FROM closed
+	`
+}
+
+// setStock stores stock less what pending reservations hold, for
+// ProductModel.SetStock and ProductVariantModel.SetStock. lockQuery locks the
+// row given lockArgs, whose first one is the row's id. heldQuery and
+// updateQuery take that id as $1, and updateQuery the new count as $2. The
+// row stays locked while the held quantity is summed, so a reservation
+// cannot be made or released in between.
+func setStock(db *sql.DB, stock int32, lockQuery string, heldQuery string, updateQuery string, lockArgs ...any) (int32, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, lockQuery, lockArgs...).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	var held int32
+	err = tx.QueryRowContext(ctx, heldQuery, id).Scan(&held)
+	if err != nil {
+		return 0, err
+	}
+
+	if stock < held {
+		return 0, ErrStockHeld
+	}
+
+	_, err = tx.ExecContext(ctx, updateQuery, id, stock-held)
+	if err != nil {
+		return 0, err
+	}
+
+	return stock - held, tx.Commit()
+}
+
+type ReservationModel struct {
+	DB *sql.DB
+}
+
+// Reserve takes the reservation's quantity out of stock and records the
+// reservation, expiring after ttl. The product or variant row is locked for
+// the duration so that concurrent checkouts cannot oversell it.
+func (m ReservationModel) Reserve(reservation *Reservation, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lockQuery := `SELECT stock FROM products WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	updateQuery := `UPDATE products SET stock = stock - $2 WHERE id = $1`
+	args := []any{reservation.ProductID}
+	if reservation.VariantID != nil {
+		lockQuery = `
+		SELECT v.stock
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1 AND v.product_id = $2 AND p.deleted_at IS NULL
+		FOR UPDATE OF v
+		`
+		updateQuery = `UPDATE product_variants SET stock = stock - $2 WHERE id = $1`
+		args = []any{*reservation.VariantID, reservation.ProductID}
+	}
+
+	var stock int32
+	err = tx.QueryRowContext(ctx, lockQuery, args...).Scan(&stock)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if stock < reservation.Quantity {
+		return ErrInsufficientStock
+	}
+
+	_, err = tx.ExecContext(ctx, updateQuery, args[0], reservation.Quantity)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO reservations (product_id, variant_id, quantity, expires_at)
+	VALUES ($1, $2, $3, NOW() + make_interval(secs => $4))
+	RETURNING ` + reservationColumns + `
+	`
+
+	err = tx.QueryRowContext(ctx, query, reservation.ProductID, reservation.VariantID, reservation.Quantity, ttl.Seconds()).Scan(reservation.fields()...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ReservationModel) Get(id int64) (*Reservation, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + reservationColumns + `
+	FROM reservations
+	WHERE id = $1
+	`
+	var reservation Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(reservation.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// Confirm marks a pending, unexpired reservation as paid for, so its stock is
+// never returned.
+func (m ReservationModel) Confirm(id int64) (*Reservation, error) {
+	query := `
+	UPDATE reservations
+	SET status = 'confirmed', updated_at = NOW()
+	WHERE id = $1 AND status = 'pending' AND expires_at > NOW()
+	RETURNING ` + reservationColumns + `
+	`
+	var reservation Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(reservation.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, m.closedOrMissing(id)
+		}
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// Release cancels a pending reservation and returns its stock.
+func (m ReservationModel) Release(id int64) (*Reservation, error) {
+	query := closeReservations("released", "id = $1")
+	var reservation Reservation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(reservation.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, m.closedOrMissing(id)
+		}
+		return nil, err
+	}
+
+	return &reservation, nil
+}
+
+// ExpireDue expires every pending reservation past its expiry time, returns
+// their stock and reports how many there were.
+func (m ReservationModel) ExpireDue() (int, error) {
+	query := closeReservations("expired", "expires_at <= NOW()")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	expired := 0
+	for rows.Next() {
+		expired++
+	}
+
+	return expired, rows.Err()
+}
+
+func (m ReservationModel) closedOrMissing(id int64) error {
+	_, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	return ErrReservationClosed
+}
+
+func ValidateReservation(v *validator.Validator, reservation *Reservation) {
+	v.Check(reservation.ProductID > 0, "product_id", "must be a positive integer")
+	v.Check(reservation.VariantID == nil || *reservation.VariantID > 0, "variant_id", "must be a positive integer")
+	v.Check(reservation.Quantity > 0, "quantity", "must be greater than zero")
+	v.Check(reservation.Quantity <= 1000, "quantity", "must not be more than 1000")
+}
+
+func ValidateStock(v *validator.Validator, stock int32) {
+	v.Check(stock >= 0, "stock", "must not be negative")
+}
@@ -0,0 +1,166 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func productStock(t *testing.T, products ProductModel, id int64) int32 {
+	t.Helper()
+
+	product, err := products.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product.Stock
+}
+
+func TestRestockDuringPendingReservations(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	products := ProductModel{DB: db}
+	reservations := ReservationModel{DB: db}
+
+	released := &Reservation{ProductID: product.ID, Quantity: 3}
+	err := reservations.Reserve(released, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiring := &Reservation{ProductID: product.ID, Quantity: 2}
+	err = reservations.Reserve(expiring, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := productStock(t, products, product.ID); got != 5 {
+		t.Fatalf("got stock %d after reserving 5 of 10; want 5", got)
+	}
+
+	// A restock to 20 on hand leaves 15 available while 5 are held.
+	available, err := products.SetStock(product.ID, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available != 15 {
+		t.Errorf("got %d available after restocking to 20; want 15", available)
+	}
+
+	_, err = reservations.Release(released.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := reservations.ExpireDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("got %d expired reservations; want 1", expired)
+	}
+
+	if got := productStock(t, products, product.ID); got != 20 {
+		t.Errorf("got stock %d once nothing is held; want the 20 on hand", got)
+	}
+}
+
+func TestSetStockBelowHeld(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	products := ProductModel{DB: db}
+
+	err := ReservationModel{DB: db}.Reserve(&Reservation{ProductID: product.ID, Quantity: 4}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = products.SetStock(product.ID, 3)
+	if !errors.Is(err, ErrStockHeld) {
+		t.Fatalf("got %v; want ErrStockHeld", err)
+	}
+
+	if got := productStock(t, products, product.ID); got != 6 {
+		t.Errorf("got stock %d after a rejected restock; want it unchanged at 6", got)
+	}
+
+	_, err = products.SetStock(product.ID+1, 3)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v for a missing product; want ErrRecordNotFound", err)
+	}
+}
+
+func TestVariantRestockDuringPendingReservation(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	variants := ProductVariantModel{DB: db}
+	reservations := ReservationModel{DB: db}
+
+	variant := &ProductVariant{ProductID: product.ID, SKU: "KETTLE-RED", Stock: 5}
+	err := variants.Insert(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reservation := &Reservation{ProductID: product.ID, VariantID: &variant.ID, Quantity: 2}
+	err = reservations.Reserve(reservation, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, err := variants.SetStock(product.ID, variant.ID, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available != 6 {
+		t.Errorf("got %d available; want 6", available)
+	}
+
+	_, err = reservations.Release(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := variants.Get(product.ID, variant.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Stock != 8 {
+		t.Errorf("got variant stock %d after the release; want the 8 on hand", stored.Stock)
+	}
+}
+
+func TestProductDeleteReleasesReservations(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	products := ProductModel{DB: db}
+	reservations := ReservationModel{DB: db}
+
+	reservation := &Reservation{ProductID: product.ID, Quantity: 3}
+	err := reservations.Reserve(reservation, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = products.Delete(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := reservations.Get(reservation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "released" {
+		t.Errorf("got status %q after the product was deleted; want released", stored.Status)
+	}
+
+	err = products.Restore(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := productStock(t, products, product.ID); got != 10 {
+		t.Errorf("got stock %d after restoring; want the held 3 back, 10", got)
+	}
+}
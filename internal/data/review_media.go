@@ -0,0 +1,216 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrTooManyMedia = errors.New("too many media")
+
+// ReviewMedia is a photo attached to a review. The image itself lives in the
+// configured storage backend under StorageKey.
+type ReviewMedia struct {
+	ID           int64     `json:"id"`
+	ReviewID     int64     `json:"review_id"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	SizeBytes    int64     `json:"size_bytes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// MediaURLPrefix is where the API serves stored objects from.
+const MediaURLPrefix = "/v1/media/"
+
+const reviewMediaColumns = `id, review_id, storage_key, thumbnail_key, content_type, width, height, size_bytes, created_at`
+
+func (media *ReviewMedia) fields() []any {
+	return []any{&media.ID, &media.ReviewID, &media.StorageKey, &media.ThumbnailKey, &media.ContentType,
+		&media.Width, &media.Height, &media.SizeBytes, &media.CreatedAt}
+}
+
+func (media *ReviewMedia) setURLs() {
+	media.URL = MediaURLPrefix + media.StorageKey
+	media.ThumbnailURL = MediaURLPrefix + media.ThumbnailKey
+}
+
+type ReviewMediaModel struct {
+	DB *sql.DB
+}
+
+// InsertBatch records photos for a review, all or none. The review row is
+// locked while the existing photos are counted, so concurrent uploads cannot
+// take a review past limit between them; ErrTooManyMedia is returned instead.
+func (m ReviewMediaModel) InsertBatch(reviewID int64, batch []*ReviewMedia, limit int) error {
+	query := `
+	INSERT INTO review_media (review_id, storage_key, thumbnail_key, content_type, width, height, size_bytes)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+	SELECT (SELECT COUNT(*) FROM review_media WHERE review_id = r.id)
+	FROM reviews r
+	WHERE r.id = $1 AND r.deleted_at IS NULL
+	FOR UPDATE OF r
+	`, reviewID).Scan(&count)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	if count+len(batch) > limit {
+		return ErrTooManyMedia
+	}
+
+	for _, media := range batch {
+		media.ReviewID = reviewID
+		args := []any{media.ReviewID, media.StorageKey, media.ThumbnailKey, media.ContentType, media.Width, media.Height, media.SizeBytes}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&media.ID, &media.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		media.setURLs()
+	}
+
+	return tx.Commit()
+}
+
+func (m ReviewMediaModel) Get(reviewID int64, id int64) (*ReviewMedia, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + reviewMediaColumns + `
+	FROM review_media
+	WHERE id = $1 AND review_id = $2
+	`
+	var media ReviewMedia
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, reviewID).Scan(media.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	media.setURLs()
+	return &media, nil
+}
+
+func (m ReviewMediaModel) Count(reviewID int64) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM review_media
+	WHERE review_id = $1
+	`
+	var count int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (m ReviewMediaModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM review_media
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// attachMedia loads the photos for a page of reviews in a single query and
+// embeds them in place.
+func attachMedia(ctx context.Context, db queryer, reviews []*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Review, len(reviews))
+	ids := make([]int64, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	query := `
+	SELECT ` + reviewMediaColumns + `
+	FROM review_media
+	WHERE review_id = ANY($1)
+	ORDER BY id
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var media ReviewMedia
+		err := rows.Scan(media.fields()...)
+		if err != nil {
+			return err
+		}
+
+		media.setURLs()
+		review := byID[media.ReviewID]
+		review.Media = append(review.Media, &media)
+	}
+
+	return rows.Err()
+}
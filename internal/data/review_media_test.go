@@ -0,0 +1,102 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func testReviewMedia(n int) []*ReviewMedia {
+	batch := make([]*ReviewMedia, n)
+	for i := range batch {
+		batch[i] = &ReviewMedia{
+			StorageKey:   fmt.Sprintf("reviews/test/%d.jpg", i),
+			ThumbnailKey: fmt.Sprintf("reviews/test/%d_thumb.jpg", i),
+			ContentType:  "image/jpeg",
+			Width:        1,
+			Height:       1,
+			SizeBytes:    1,
+		}
+	}
+	return batch
+}
+
+func TestReviewMediaInsertBatchLimit(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 4}
+	err := ReviewModel{DB: db}.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reviewMedia := ReviewMediaModel{DB: db}
+
+	err = reviewMedia.InsertBatch(review.ID, testReviewMedia(2), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reviewMedia.InsertBatch(review.ID, testReviewMedia(2), 3)
+	if !errors.Is(err, ErrTooManyMedia) {
+		t.Fatalf("got %v; want ErrTooManyMedia", err)
+	}
+
+	count, err := reviewMedia.Count(review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("got %d photos; want the rejected batch not stored", count)
+	}
+
+	err = reviewMedia.InsertBatch(review.ID+1, testReviewMedia(1), 3)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v for a missing review; want ErrRecordNotFound", err)
+	}
+}
+
+func TestOrphanedObjectsQueuedOnCascade(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 4}
+	err := ReviewModel{DB: db}.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ReviewMediaModel{DB: db}.InsertBatch(review.ID, testReviewMedia(1), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`DELETE FROM products WHERE id = $1`, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphans := OrphanedObjectModel{DB: db}
+
+	keys, err := orphans.Pending(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got queued keys %v; want the photo and its thumbnail", keys)
+	}
+
+	err = orphans.Forget(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err = orphans.Pending(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("got queued keys %v after Forget; want none", keys)
+	}
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+var ErrDuplicateResponse = errors.New("duplicate response")
+
+type ReviewResponse struct {
+	ID        int64     `json:"id"`
+	ReviewID  int64     `json:"review_id"`
+	Seller    string    `json:"seller"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ReviewResponseModel struct {
+	DB *sql.DB
+}
+
+func (m ReviewResponseModel) Insert(response *ReviewResponse) error {
+	query := `
+	INSERT INTO review_responses (review_id, seller, body)
+	VALUES ($1, $2, $3)
+	RETURNING id, created_at, updated_at
+	`
+	args := []any{response.ReviewID, response.Seller, response.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&response.ID, &response.CreatedAt, &response.UpdatedAt)
+	if err != nil {
+		switch {
+		case violates(err, uniqueViolation, "review_responses_review_id_key"):
+			return ErrDuplicateResponse
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewResponseModel) Get(reviewID int64) (*ReviewResponse, error) {
+	if reviewID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, review_id, seller, body, created_at, updated_at
+	FROM review_responses
+	WHERE review_id = $1
+	`
+	var response ReviewResponse
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, reviewID).Scan(&response.ID, &response.ReviewID, &response.Seller, &response.Body, &response.CreatedAt, &response.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (m ReviewResponseModel) Update(response *ReviewResponse) error {
+	query := `
+	UPDATE review_responses
+	SET body = $1, updated_at = NOW()
+	WHERE id = $2
+	RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, response.Body, response.ID).Scan(&response.UpdatedAt)
+}
+
+func (m ReviewResponseModel) Delete(reviewID int64) error {
+	if reviewID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	DELETE FROM review_responses
+	WHERE review_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, reviewID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// attachResponses loads the seller responses for a page of reviews in a
+// single query and embeds them in place.
+func attachResponses(ctx context.Context, db queryer, reviews []*Review) error {
+	if len(reviews) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Review, len(reviews))
+	ids := make([]int64, 0, len(reviews))
+	for _, review := range reviews {
+		byID[review.ID] = review
+		ids = append(ids, review.ID)
+	}
+
+	query := `
+	SELECT id, review_id, seller, body, created_at, updated_at
+	FROM review_responses
+	WHERE review_id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var response ReviewResponse
+		err := rows.Scan(&response.ID, &response.ReviewID, &response.Seller, &response.Body, &response.CreatedAt, &response.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		byID[response.ReviewID].Response = &response
+	}
+
+	return rows.Err()
+}
+
+func ValidateReviewResponse(v *validator.Validator, response *ReviewResponse) {
+	v.Check(response.Seller != "", "seller", "must be provided")
+	v.Check(response.Body != "", "body", "must be provided")
+	v.Check(len(response.Body) <= 2000, "body", "must not be more than 2000 bytes long")
+}
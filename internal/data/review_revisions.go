@@ -0,0 +1,60 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ReviewRevision is the content a review had before an edit replaced it.
+type ReviewRevision struct {
+	ID       int64     `json:"id"`
+	ReviewID int64     `json:"review_id"`
+	Author   string    `json:"author"`
+	Rating   int64     `json:"rating"`
+	Text     string    `json:"text"`
+	Editor   string    `json:"editor"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+type ReviewRevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns every revision of the review, newest first.
+func (m ReviewRevisionModel) GetAll(reviewID int64) ([]*ReviewRevision, error) {
+	query := `
+	SELECT id, review_id, author, rating, text, editor, edited_at
+	FROM review_revisions
+	WHERE review_id = $1
+	ORDER BY edited_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ReviewRevision{}
+
+	for rows.Next() {
+		var revision ReviewRevision
+		err := rows.Scan(&revision.ID, &revision.ReviewID, &revision.Author, &revision.Rating, &revision.Text, &revision.Editor, &revision.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
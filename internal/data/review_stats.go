@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// bayesianPriorWeight is how many "average" reviews every product is assumed
+// to start with, so a single 5-star review cannot outrank an established
+// product.
+const bayesianPriorWeight = 10
+
+// reviewStatsTTL bounds how stale the rolling window counts may get before
+// the cached row is recomputed.
+const reviewStatsTTL = time.Hour
+
+type ReviewStats struct {
+	ProductID          int64              `json:"product_id"`
+	Distribution       map[string]int64   `json:"distribution"`
+	Total              int64              `json:"total"`
+	Mean               float64            `json:"mean"`
+	Median             float64            `json:"median"`
+	BayesianScore      float64            `json:"bayesian_score"`
+	PercentRecommended float64            `json:"percent_recommended"`
+	Last30Days         int64              `json:"last_30_days"`
+	Last90Days         int64              `json:"last_90_days"`
+	Last365Days        int64              `json:"last_365_days"`
+	AspectAverages     map[string]float64 `json:"aspect_averages"`
+	ComputedAt         time.Time          `json:"computed_at"`
+}
+
+type ReviewStatsModel struct {
+	DB *sql.DB
+}
+
+const reviewStatsColumns = `product_id, stars_1, stars_2, stars_3, stars_4, stars_5, total, mean, median,
+	bayesian_score, percent_recommended, last_30_days, last_90_days, last_365_days, aspect_averages, computed_at`
+
+// Get returns the cached statistics for the product, recomputing them when
+// the cache is missing or older than reviewStatsTTL.
+func (s ReviewStatsModel) Get(productID int64) (*ReviewStats, error) {
+	if productID < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT ` + reviewStatsColumns + `
+	FROM product_review_stats
+	WHERE product_id = $1 AND computed_at > $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats, err := scanReviewStats(s.DB.QueryRowContext(ctx, query, productID, time.Now().Add(-reviewStatsTTL)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s.Refresh(productID)
+		}
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// refreshAttempts is how many times Refresh recomputes statistics that were
+// invalidated while it was computing them.
+const refreshAttempts = 3
+
+// Refresh recomputes the statistics for the product from the reviews table
+// and stores them in the cache in the same round-trip. A review counts as
+// recommending the product when it is rated 4 stars or more.
+//
+// The statistics are only stored if the cached row's version is still the
+// one the computation saw. A review change committed in between bumps it, so
+// the older figures are computed again rather than cached over it.
+func (s ReviewStatsModel) Refresh(productID int64) (*ReviewStats, error) {
+	query := `
+	INSERT INTO product_review_stats (` + reviewStatsColumns + `, version)
+	SELECT $1,
+		COUNT(*) FILTER (WHERE rating = 1),
+		COUNT(*) FILTER (WHERE rating = 2),
+		COUNT(*) FILTER (WHERE rating = 3),
+		COUNT(*) FILTER (WHERE rating = 4),
+		COUNT(*) FILTER (WHERE rating = 5),
+		COUNT(*),
+		COALESCE(AVG(rating), 0)::double precision,
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY rating), 0)::double precision,
+		((($2::integer * (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE deleted_at IS NULL)) + COALESCE(SUM(rating), 0)) / ($2::integer + COUNT(*)))::double precision,
+		COALESCE(100.0 * COUNT(*) FILTER (WHERE rating >= 4) / NULLIF(COUNT(*), 0), 0)::double precision,
+		COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '30 days'),
+		COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '90 days'),
+		COUNT(*) FILTER (WHERE created_at > NOW() - INTERVAL '365 days'),
+		(SELECT COALESCE(jsonb_object_agg(aspects.name, aspects.average), '{}')
+			FROM (
+				SELECT a.name, AVG(rar.rating)::double precision AS average
+				FROM review_aspect_ratings rar
+				JOIN rating_aspects a ON a.id = rar.aspect_id
+				JOIN reviews r ON r.id = rar.review_id
+				WHERE r.product_id = $1 AND r.deleted_at IS NULL
+				GROUP BY a.name
+			) aspects),
+		NOW(),
+		COALESCE((SELECT version FROM product_review_stats WHERE product_id = $1), 0)
+	FROM reviews
+	WHERE product_id = $1 AND deleted_at IS NULL
+	ON CONFLICT (product_id) DO UPDATE
+	SET stars_1 = EXCLUDED.stars_1, stars_2 = EXCLUDED.stars_2, stars_3 = EXCLUDED.stars_3,
+		stars_4 = EXCLUDED.stars_4, stars_5 = EXCLUDED.stars_5, total = EXCLUDED.total,
+		mean = EXCLUDED.mean, median = EXCLUDED.median, bayesian_score = EXCLUDED.bayesian_score,
+		percent_recommended = EXCLUDED.percent_recommended, last_30_days = EXCLUDED.last_30_days,
+		last_90_days = EXCLUDED.last_90_days, last_365_days = EXCLUDED.last_365_days,
+		aspect_averages = EXCLUDED.aspect_averages, computed_at = EXCLUDED.computed_at
+	WHERE product_review_stats.version = EXCLUDED.version
+	RETURNING ` + reviewStatsColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var err error
+	for range refreshAttempts {
+		var stats *ReviewStats
+		stats, err = scanReviewStats(s.DB.QueryRowContext(ctx, query, productID, bayesianPriorWeight))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return stats, err
+		}
+	}
+
+	return nil, err
+}
+
+func scanReviewStats(row *sql.Row) (*ReviewStats, error) {
+	var stats ReviewStats
+	var stars [5]int64
+	var aspectAverages []byte
+
+	err := row.Scan(&stats.ProductID, &stars[0], &stars[1], &stars[2], &stars[3], &stars[4], &stats.Total, &stats.Mean, &stats.Median,
+		&stats.BayesianScore, &stats.PercentRecommended, &stats.Last30Days, &stats.Last90Days, &stats.Last365Days, &aspectAverages, &stats.ComputedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(aspectAverages, &stats.AspectAverages)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Distribution = map[string]int64{
+		"1": stars[0],
+		"2": stars[1],
+		"3": stars[2],
+		"4": stars[3],
+		"5": stars[4],
+	}
+
+	return &stats, nil
+}
+
+// invalidateReviewStats marks the cached statistics for the product as out
+// of date so the next read recomputes them, and bumps their version so that
+// a Refresh already under way does not store what it computed. It runs in the
+// transaction that changes the reviews, so the cache can never outlive a
+// committed change.
+func invalidateReviewStats(ctx context.Context, tx *sql.Tx, productID int64) error {
+	query := `
+	INSERT INTO product_review_stats (product_id, computed_at, version)
+	VALUES ($1, '-infinity', 1)
+	ON CONFLICT (product_id) DO UPDATE
+	SET computed_at = '-infinity', version = product_review_stats.version + 1
+	`
+	_, err := tx.ExecContext(ctx, query, productID)
+	return err
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestReviewStatsInvalidatedByWrites(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Toaster")
+	reviews := ReviewModel{DB: db}
+	stats := ReviewStatsModel{DB: db}
+
+	err := reviews.Insert(&Review{ProductID: product.ID, Author: "ana", Rating: 5, Text: "great"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := stats.Get(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Total != 1 || cached.Mean != 5 {
+		t.Fatalf("got total %d and mean %v; want 1 and 5", cached.Total, cached.Mean)
+	}
+
+	second := &Review{ProductID: product.ID, Author: "ben", Rating: 1, Text: "broke"}
+	err = reviews.Insert(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err := stats.Get(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Total != 2 || fresh.Mean != 3 {
+		t.Errorf("after a new review got total %d and mean %v; want 2 and 3", fresh.Total, fresh.Mean)
+	}
+
+	err = reviews.Delete(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh, err = stats.Get(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Total != 1 {
+		t.Errorf("after deleting a review got total %d; want 1", fresh.Total)
+	}
+}
+
+func TestReviewStatsRefreshDuringWrite(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Toaster")
+	stats := ReviewStatsModel{DB: db}
+
+	err := ReviewModel{DB: db}.Insert(&Review{ProductID: product.ID, Author: "ana", Rating: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stats.Get(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A review write that has invalidated the cache but not yet committed.
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO reviews (product_id, author, rating, text, helpful_count) VALUES ($1, 'ben', 1, '', 0)`, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = invalidateReviewStats(ctx, tx, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh reads the reviews before the write commits and then waits
+	// on the cached row, which the write holds.
+	refreshed := make(chan *ReviewStats)
+	go func() {
+		result, err := stats.Refresh(product.ID)
+		if err != nil {
+			t.Error(err)
+		}
+		refreshed <- result
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := <-refreshed
+	if result == nil {
+		return
+	}
+	if result.Total != 2 {
+		t.Errorf("got total %d from a refresh that raced a write; want the 2 reviews committed", result.Total)
+	}
+
+	cached, err := stats.Get(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Total != 2 {
+		t.Errorf("got cached total %d; want 2", cached.Total)
+	}
+}
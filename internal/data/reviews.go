@@ -7,16 +7,55 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/thats-insane/awt-test1/internal/validator"
 )
 
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+	ErrDuplicateVote   = errors.New("duplicate vote")
+)
+
 type Review struct {
-	ID           int64     `json:"id"`
-	ProductID    int64     `json:"product_id"`
-	Author       string    `json:"author"`
-	Rating       int64     `json:"rating"`
-	HelpfulCount int32     `json:"helpful_count"`
-	CreatedAt    time.Time `json:"-"`
+	ID             int64            `json:"id"`
+	ProductID      int64            `json:"product_id"`
+	VariantID      *int64           `json:"variant_id,omitempty"`
+	Author         string           `json:"author"`
+	Rating         int64            `json:"rating"`
+	Aspects        map[string]int64 `json:"aspects,omitempty"`
+	Text           string           `json:"text"`
+	HelpfulCount   int32            `json:"helpful_count"`
+	Verified       bool             `json:"verified_purchase"`
+	UnhelpfulCount int32            `json:"unhelpful_count"`
+	Response       *ReviewResponse  `json:"response,omitempty"`
+	Media          []*ReviewMedia   `json:"media,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	EditedAt       *time.Time       `json:"edited_at,omitempty"`
+	DeletedAt      *time.Time       `json:"deleted_at,omitempty"`
+}
+
+// verifiedPurchase is true when the author had ordered the product before
+// writing the review. Until there are user accounts, an order's customer is
+// matched against the review's author.
+const verifiedPurchase = `EXISTS (
+	SELECT 1
+	FROM orders o
+	JOIN order_items oi ON oi.order_id = o.id
+	WHERE o.customer = reviews.author
+		AND oi.product_id = reviews.product_id
+		AND o.placed_at <= reviews.created_at
+	)`
+
+// reviewOfLiveProduct excludes reviews whose product is in the trash.
+const reviewOfLiveProduct = `NOT EXISTS (SELECT 1 FROM products p WHERE p.id = reviews.product_id AND p.deleted_at IS NOT NULL)`
+
+const reviewColumns = `id, product_id, variant_id, author, rating, text, helpful_count, unhelpful_count, created_at, updated_at, edited_at, ` + verifiedPurchase
+
+// fields returns the scan destinations matching reviewColumns.
+func (review *Review) fields() []any {
+	return []any{&review.ID, &review.ProductID, &review.VariantID, &review.Author, &review.Rating, &review.Text, &review.HelpfulCount,
+		&review.UnhelpfulCount, &review.CreatedAt, &review.UpdatedAt, &review.EditedAt, &review.Verified}
 }
 
 type ReviewModel struct {
@@ -25,16 +64,96 @@ type ReviewModel struct {
 
 func (r ReviewModel) Insert(review *Review) error {
 	query := `
-	INSERT INTO reviews (product_id, author, rating, helpful_count)
-	VALUES ($1, $2, $3, $4, COALESCE($5, 0))
-	RETURNING id, created_at, version
+	INSERT INTO reviews (product_id, variant_id, author, rating, text, helpful_count)
+	VALUES ($1, $2, $3, $4, $5, 0)
+	RETURNING id, created_at, updated_at, ` + verifiedPurchase + `
+	`
+	args := []any{review.ProductID, review.VariantID, review.Author, review.Rating, review.Text}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Verified)
+	if err != nil {
+		switch {
+		case violates(err, uniqueViolation, "reviews_product_author_key"):
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = saveAspectRatings(ctx, tx, review.ID, review.Aspects)
+	if err != nil {
+		return err
+	}
+
+	err = invalidateReviewStats(ctx, tx, review.ProductID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Upsert creates the author's review for the product, or replaces the rating
+// and text of the one they already wrote, keeping the replaced content as a
+// revision. It reports whether a new row was created.
+func (r ReviewModel) Upsert(review *Review) (bool, error) {
+	query := `
+	WITH previous AS (
+		SELECT id, author, rating, text
+		FROM reviews
+		WHERE product_id = $1 AND author = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	), revision AS (
+		INSERT INTO review_revisions (review_id, author, rating, text, editor)
+		SELECT id, author, rating, text, author
+		FROM previous
+		WHERE rating <> $3 OR text <> $4
+	)
+	INSERT INTO reviews (product_id, variant_id, author, rating, text, helpful_count)
+	VALUES ($1, $5, $2, $3, $4, 0)
+	ON CONFLICT (product_id, author) WHERE deleted_at IS NULL DO UPDATE
+	SET variant_id = EXCLUDED.variant_id, rating = EXCLUDED.rating, text = EXCLUDED.text, updated_at = NOW(),
+		edited_at = CASE WHEN reviews.rating <> EXCLUDED.rating OR reviews.text <> EXCLUDED.text
+			THEN NOW() ELSE reviews.edited_at END
+	RETURNING ` + reviewColumns + `, (xmax = 0) AS inserted
 	`
-	args := []any{review.ProductID, review.Author, review.Rating, review.HelpfulCount}
+	args := []any{review.ProductID, review.Author, review.Rating, review.Text, review.VariantID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID)
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var inserted bool
+	err = tx.QueryRowContext(ctx, query, args...).Scan(append(review.fields(), &inserted)...)
+	if err != nil {
+		return false, err
+	}
+
+	err = saveAspectRatings(ctx, tx, review.ID, review.Aspects)
+	if err != nil {
+		return false, err
+	}
+
+	err = invalidateReviewStats(ctx, tx, review.ProductID)
+	if err != nil {
+		return false, err
+	}
+
+	return inserted, tx.Commit()
 }
 
 func (r ReviewModel) Get(id int64) (*Review, error) {
@@ -42,42 +161,101 @@ func (r ReviewModel) Get(id int64) (*Review, error) {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-	SELECT id, product_id, author, rating, text, helpful_count, created_at, version
+	SELECT ` + reviewColumns + `
 	FROM reviews
-	WHERE id = $1
+	WHERE id = $1 AND deleted_at IS NULL AND ` + reviewOfLiveProduct + `
 	`
 	var review Review
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := r.DB.QueryRowContext(ctx, query, id).Scan(&review.ID, &review.ProductID, &review.Author, &review.Rating, &review.HelpfulCount, &review.CreatedAt)
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(review.fields()...)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
+	err = attachResponses(ctx, r.DB, []*Review{&review})
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachAspectRatings(ctx, r.DB, []*Review{&review})
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachMedia(ctx, r.DB, []*Review{&review})
+	if err != nil {
+		return nil, err
+	}
+
 	return &review, nil
 }
 
-func (r ReviewModel) GetAll(author string, rating string, helpfulCount string, filters Filters) ([]*Review, Metadata, error) {
-	query := fmt.Sprintf(`
-	SELECT COUNT(*) OVER(), id, product_id, author, rating, helpful_count, created_at
+func (r ReviewModel) GetByAuthor(productID int64, author string) (*Review, error) {
+	query := `
+	SELECT ` + reviewColumns + `
 	FROM reviews
-	WHERE (to_tsvector('simple', author) @@
+	WHERE product_id = $1 AND author = $2 AND deleted_at IS NULL
+	`
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, productID, author).Scan(review.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ReviewFilter holds the list filters shared by GetAll and Export. A nil
+// Verified matches both verified and unverified purchases.
+type ReviewFilter struct {
+	Author       string
+	Rating       string
+	HelpfulCount string
+	Verified     *bool
+}
+
+const reviewFilterClause = `
+	deleted_at IS NULL
+	AND ` + reviewOfLiveProduct + `
+	AND (to_tsvector('simple', author) @@
 		plainto_tsquery('simple', $1) OR $1 = '') 
-	AND (to_tsvector('simple', rating) @@
+	AND (to_tsvector('simple', rating::text) @@
 		plainto_tsquery('simple', $2) OR $2 = '') 
-	AND (to_tsvector('simple', helpful_count) @@
+	AND (to_tsvector('simple', helpful_count::text) @@
 		plainto_tsquery('simple', $3) OR $3 = '') 
-	ORDER BY %s %s, id ASC 
-	LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+	AND ($4::boolean IS NULL OR ` + verifiedPurchase + ` = $4)`
+
+// args returns the parameters of reviewFilterClause.
+func (f ReviewFilter) args() []any {
+	return []any{f.Author, f.Rating, f.HelpfulCount, f.Verified}
+}
+
+// GetAll lists reviews matching the filter.
+func (r ReviewModel) GetAll(filter ReviewFilter, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), %s
+	FROM reviews
+	WHERE %s
+	ORDER BY %s, id ASC 
+	LIMIT $5 OFFSET $6`, reviewColumns, reviewFilterClause, reviewOrderBy(filters))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := r.DB.QueryContext(ctx, query, author, rating, helpfulCount, filters.limit(), filters.offset())
+	args := append(filter.args(), filters.limit(), filters.offset())
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -88,7 +266,7 @@ func (r ReviewModel) GetAll(author string, rating string, helpfulCount string, f
 
 	for rows.Next() {
 		var review Review
-		err := rows.Scan(&totalRecords, &review.ID, &review.ProductID, &review.Author, &review.Rating, &review.HelpfulCount, &review.CreatedAt)
+		err := rows.Scan(append([]any{&totalRecords}, review.fields()...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -101,59 +279,332 @@ func (r ReviewModel) GetAll(author string, rating string, helpfulCount string, f
 		return nil, Metadata{}, err
 	}
 
+	err = attachResponses(ctx, r.DB, reviews)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachAspectRatings(ctx, r.DB, reviews)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = attachMedia(ctx, r.DB, reviews)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
 
 	return reviews, metadata, nil
 }
 
-func (r ReviewModel) Update(review *Review) error {
+// wilsonScore is the lower bound of the 95% Wilson score interval for the
+// share of helpful votes. Reviews with few votes are pulled towards zero, so
+// a 1/1 review does not outrank a 90/100 one.
+const wilsonScore = `
+	CASE WHEN helpful_count + unhelpful_count = 0 THEN 0
+	ELSE ((helpful_count + 1.9208) / (helpful_count + unhelpful_count) -
+		1.96 * SQRT((helpful_count * unhelpful_count) / (helpful_count + unhelpful_count)::numeric + 0.9604) /
+		(helpful_count + unhelpful_count)) / (1 + 3.8416 / (helpful_count + unhelpful_count))
+	END`
+
+// reviewOrderBy turns the computed ranking modes into ORDER BY expressions
+// and falls back to the plain column sort for everything else.
+func reviewOrderBy(filters Filters) string {
+	switch filters.Sort {
+	case "most_helpful":
+		return wilsonScore + " DESC"
+	case "most_recent":
+		return "created_at DESC"
+	case "critical":
+		return "rating ASC, " + wilsonScore + " DESC"
+	default:
+		return fmt.Sprintf("%s %s", filters.sortColumn(), filters.sortDirection())
+	}
+}
+
+// Vote records a helpful or unhelpful vote against the review and returns
+// the updated counts.
+func (r ReviewModel) Vote(id int64, voter string, helpful bool) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE reviews
+	SET helpful_count = helpful_count + CASE WHEN $2 THEN 1 ELSE 0 END,
+		unhelpful_count = unhelpful_count + CASE WHEN $2 THEN 0 ELSE 1 END,
+		updated_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL AND ` + reviewOfLiveProduct + `
+	RETURNING ` + reviewColumns + `
+	`
+	voteQuery := `
+	INSERT INTO review_votes (review_id, voter, helpful)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (review_id, voter) DO NOTHING
+	`
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, id, helpful).Scan(review.fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, voteQuery, id, voter, helpful)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrDuplicateVote
+	}
+
+	return &review, tx.Commit()
+}
+
+// Update saves the review. When the author, rating or text changed, the
+// previous content is kept in review_revisions along with who edited it.
+// Aspect scores are only replaced when review.Aspects is non-nil.
+func (r ReviewModel) Update(review *Review, editor string) error {
 	query := `
+	WITH previous AS (
+		SELECT id, author, rating, text
+		FROM reviews
+		WHERE id = $4 AND deleted_at IS NULL
+		FOR UPDATE
+	), revision AS (
+		INSERT INTO review_revisions (review_id, author, rating, text, editor)
+		SELECT id, author, rating, text, $5
+		FROM previous
+		WHERE author <> $1 OR rating <> $2 OR text <> $3
+	)
 	UPDATE reviews
-	SET author = $1, rating = $2, helpful_count = $3
-	WHERE id = $4
-	RETURNING id
+	SET author = $1, rating = $2, text = $3, variant_id = $6, updated_at = NOW(),
+		edited_at = CASE WHEN author <> $1 OR rating <> $2 OR text <> $3
+			THEN NOW() ELSE edited_at END
+	WHERE id = $4 AND deleted_at IS NULL
+	RETURNING updated_at, edited_at, ` + verifiedPurchase + `
 	`
 
-	args := []any{review.Author, review.Rating, review.HelpfulCount, review.ID}
+	args := []any{review.Author, review.Rating, review.Text, review.ID, editor, review.VariantID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID)
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.EditedAt, &review.Verified)
+	if err != nil {
+		switch {
+		case violates(err, uniqueViolation, "reviews_product_author_key"):
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	if review.Aspects != nil {
+		err = saveAspectRatings(ctx, tx, review.ID, review.Aspects)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = invalidateReviewStats(ctx, tx, review.ProductID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// Delete moves the review to the trash. It no longer counts towards the
+// product's stats but can be restored until the purge job removes it.
 func (r ReviewModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	query := `
-	DELETE FROM reviews
-	WHERE id = $1
+	UPDATE reviews
+	SET deleted_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL
+	RETURNING product_id
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := r.DB.ExecContext(ctx, query, id)
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var productID int64
+	err = tx.QueryRowContext(ctx, query, id).Scan(&productID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
 		return err
 	}
-	if rowsAffected == 0 {
+
+	err = invalidateReviewStats(ctx, tx, productID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore takes a review back out of the trash. It fails with
+// ErrDuplicateReview if the author has since written a new review of the
+// same product.
+func (r ReviewModel) Restore(id int64) error {
+	if id < 1 {
 		return ErrRecordNotFound
 	}
+	query := `
+	UPDATE reviews
+	SET deleted_at = NULL
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING product_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return nil
+	var productID int64
+	err = tx.QueryRowContext(ctx, query, id).Scan(&productID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case violates(err, uniqueViolation, "reviews_product_author_key"):
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	err = invalidateReviewStats(ctx, tx, productID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDeleted lists the reviews in the trash.
+func (r ReviewModel) GetDeleted(filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT COUNT(*) OVER(), %s, deleted_at
+	FROM reviews
+	WHERE deleted_at IS NOT NULL
+	ORDER BY %s %s, id ASC
+	LIMIT $1 OFFSET $2`, reviewColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	var totalRecords int
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(append(append([]any{&totalRecords}, review.fields()...), &review.DeletedAt)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// Purge permanently removes reviews that have been in the trash for longer
+// than retention. It returns how many were removed. The storage keys of
+// their photos are queued in orphaned_objects by the delete trigger.
+func (r ReviewModel) Purge(retention time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT id
+	FROM reviews
+	WHERE deleted_at <= NOW() - make_interval(secs => $1)
+	FOR UPDATE
+	`
+
+	ids, err := queryIDs(ctx, tx, query, retention.Seconds())
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM reviews WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
 }
 
 func (r *ReviewModel) Exists(id int64) (bool, error) {
 	query := `
 	SELECT EXISTS
-	(SELECT 1 FROM reviews WHERE id = $1)
+	(SELECT 1 FROM reviews WHERE id = $1 AND deleted_at IS NULL AND ` + reviewOfLiveProduct + `)
 	`
 	var exists bool
 
@@ -165,9 +616,29 @@ func (r *ReviewModel) Exists(id int64) (bool, error) {
 	return exists, nil
 }
 
-func ValidateReview(v *validator.Validator, review *Review) {
+// ValidateVoter checks the name a vote is cast under. Each voter gets one
+// vote per review.
+func ValidateVoter(v *validator.Validator, voter string) {
+	v.Check(voter != "", "voter", "must be provided")
+	v.Check(len(voter) <= 100, "voter", "must not be more than 100 bytes long")
+}
+
+// ValidateReview checks the review, including that every aspect score names
+// one of the aspects declared for the product's category.
+func ValidateReview(v *validator.Validator, review *Review, aspects []*RatingAspect) {
 	v.Check(review.Author != "", "author", "must be provided")
 	v.Check(len(review.Author) <= 25, "author", "must not be more than 25 bytes long")
 	v.Check(review.ProductID > 0, "product_id", "must be a positive integer")
 	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(review.Text) <= 2000, "text", "must not be more than 2000 bytes long")
+
+	declared := make(map[string]bool, len(aspects))
+	for _, aspect := range aspects {
+		declared[aspect.Name] = true
+	}
+
+	for name, rating := range review.Aspects {
+		v.Check(declared[name], "aspects."+name, "is not a rating aspect for this product")
+		v.Check(rating >= 1 && rating <= 5, "aspects."+name, "must be between 1 and 5")
+	}
 }
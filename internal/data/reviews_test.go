@@ -0,0 +1,160 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+func TestReviewOnePerAuthor(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	reviews := ReviewModel{DB: db}
+
+	first := &Review{ProductID: product.ID, Author: "ana", Rating: 4, Text: "good"}
+	err := reviews.Insert(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reviews.Insert(&Review{ProductID: product.ID, Author: "ana", Rating: 2, Text: "again"})
+	if !errors.Is(err, ErrDuplicateReview) {
+		t.Fatalf("got %v; want ErrDuplicateReview", err)
+	}
+
+	replacement := &Review{ProductID: product.ID, Author: "ana", Rating: 5, Text: "better"}
+	inserted, err := reviews.Upsert(replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted || replacement.ID != first.ID {
+		t.Errorf("upsert inserted = %t with id %d; want the update of review %d", inserted, replacement.ID, first.ID)
+	}
+
+	revisions, err := ReviewRevisionModel{DB: db}.GetAll(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Text != "good" {
+		t.Errorf("got revisions %+v; want the replaced text kept", revisions)
+	}
+}
+
+func TestReviewVoteOncePerVoter(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Toaster")
+	reviews := ReviewModel{DB: db}
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 4, Text: "good"}
+	err := reviews.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reviews.Vote(review.ID, "bo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reviews.Vote(review.ID, "bo", false)
+	if !errors.Is(err, ErrDuplicateVote) {
+		t.Fatalf("got %v; want ErrDuplicateVote", err)
+	}
+
+	voted, err := reviews.Vote(review.ID, "cy", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voted.HelpfulCount != 1 || voted.UnhelpfulCount != 1 {
+		t.Errorf("got %d helpful and %d unhelpful; want 1 and 1", voted.HelpfulCount, voted.UnhelpfulCount)
+	}
+
+	_, err = reviews.Vote(review.ID+1, "bo", true)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v voting on a missing review; want ErrRecordNotFound", err)
+	}
+}
+
+func TestValidateReviewAspects(t *testing.T) {
+	aspects := []*RatingAspect{{Category: "kettles", Name: "noise"}}
+
+	tests := []struct {
+		name    string
+		ratings map[string]int64
+		wantErr string
+	}{
+		{"no aspects", nil, ""},
+		{"declared aspect", map[string]int64{"noise": 4}, ""},
+		{"undeclared aspect", map[string]int64{"battery": 4}, "aspects.battery"},
+		{"out of range", map[string]int64{"noise": 6}, "aspects.noise"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &Review{ProductID: 1, Author: "ana", Rating: 4, Aspects: tt.ratings}
+
+			v := validator.New()
+			ValidateReview(v, review, aspects)
+
+			if tt.wantErr == "" && !v.IsEmpty() {
+				t.Errorf("got errors %v; want none", v.Errors)
+			}
+			if _, ok := v.Errors[tt.wantErr]; tt.wantErr != "" && !ok {
+				t.Errorf("got errors %v; want one for %s", v.Errors, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReviewOfDeletedProduct(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Kettle")
+	reviews := ReviewModel{DB: db}
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 4}
+	err := reviews.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ProductModel{DB: db}.Delete(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reviews.Get(review.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v for a review of a deleted product; want ErrRecordNotFound", err)
+	}
+
+	exists, err := reviews.Exists(review.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("got a review of a deleted product reported as existing")
+	}
+}
+
+func TestReviewVoteOnDeletedProduct(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Blender")
+	reviews := ReviewModel{DB: db}
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 4}
+	err := reviews.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ProductModel{DB: db}.Delete(product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = reviews.Vote(review.ID, "bo", true)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("got %v voting on a review of a deleted product; want ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,481 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrUnknownSearchLanguage = errors.New("unknown text search configuration")
+
+// searchReindexTimeout bounds rebuilding every search vector after the
+// search language changes.
+const searchReindexTimeout = 30 * time.Minute
+
+// searchQuery parses the q parameter of a product listing, $10 in
+// productFilterClause, with the search language in $11.
+const searchQuery = `websearch_to_tsquery($11::regconfig, $10)`
+
+// ts_headline marks matches with these private-use characters rather than
+// with tags, so that the text around them can be HTML-escaped before the
+// marks are turned into <mark> elements by highlightHTML.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// Headline options for search snippets. Names are short enough to highlight
+// in full; descriptions are cut down to the fragments around the matches.
+const (
+	nameHeadlineOptions        = `HighlightAll=true, StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+	descriptionHeadlineOptions = `MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … ", StartSel="` + highlightStart + `", StopSel="` + highlightStop + `"`
+)
+
+var highlightMarks = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// highlightHTML turns a ts_headline snippet into HTML: the text is escaped
+// and the match markers become <mark> elements.
+func highlightHTML(headline string) string {
+	return highlightMarks.Replace(html.EscapeString(headline))
+}
+
+// productOrderBy turns sort=relevance into a ranking against the search
+// query, or by name similarity for fuzzy searches, and falls back to the
+// plain column sort for everything else.
+func productOrderBy(filter ProductFilter, filters Filters) string {
+	switch {
+	case filters.Sort == "relevance" && filter.Fuzzy:
+		return "word_similarity($10, name) DESC"
+	case filters.Sort == "relevance":
+		return "ts_rank_cd(search_vector, " + searchQuery + ") DESC"
+	}
+	return fmt.Sprintf("%s %s", filters.sortColumn(), filters.sortDirection())
+}
+
+// attachHighlights adds ts_headline snippets of the name and description to
+// a page of search results. They are built here, for the page only, because
+// ts_headline has to re-parse the text of every row it is given.
+func attachHighlights(ctx context.Context, db *sql.DB, products []*Product, search string, language string) error {
+	if len(products) == 0 || search == "" {
+		return nil
+	}
+
+	byID := make(map[int64]*Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+		ids = append(ids, product.ID)
+	}
+
+	query := `
+	SELECT p.id, ts_headline($3::regconfig, p.name, q, $4), ts_headline($3::regconfig, p.description, q, $5)
+	FROM products p, websearch_to_tsquery($3::regconfig, $2) AS q
+	WHERE p.id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids), search, language, nameHeadlineOptions, descriptionHeadlineOptions)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name, description string
+		err := rows.Scan(&id, &name, &description)
+		if err != nil {
+			return err
+		}
+
+		byID[id].Highlights = map[string]string{
+			"name":        highlightHTML(name),
+			"description": highlightHTML(description),
+		}
+	}
+
+	return rows.Err()
+}
+
+// didYouMean suggests product names close to a search that matched nothing.
+func (p ProductModel) didYouMean(search string) ([]string, error) {
+	query := `
+	SELECT name
+	FROM products
+	WHERE deleted_at IS NULL AND $1 % name
+	GROUP BY name
+	ORDER BY MAX(similarity($1, name)) DESC, name
+	LIMIT 3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query, search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []string{}
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, name)
+	}
+
+	return suggestions, rows.Err()
+}
+
+// Suggestion is an autocomplete entry. Products carry their id and
+// categories their slug.
+type Suggestion struct {
+	ID   int64  `json:"id,omitempty"`
+	Slug string `json:"slug,omitempty"`
+	Name string `json:"name"`
+}
+
+type Suggestions struct {
+	Products   []Suggestion `json:"products"`
+	Categories []Suggestion `json:"categories"`
+}
+
+// likePrefix escapes the LIKE wildcards in prefix and lower-cases it so it
+// can use the lower(name) text_pattern_ops index.
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
+
+// Suggest returns the product and category names starting with prefix for
+// autocomplete. Products are ordered best rated first.
+func (p ProductModel) Suggest(prefix string, limit int) (*Suggestions, error) {
+	productQuery := `
+	SELECT id, name
+	FROM products
+	WHERE deleted_at IS NULL AND lower(name) LIKE $1
+	ORDER BY average_rating DESC, lower(name), id
+	LIMIT $2
+	`
+	categoryQuery := `
+	SELECT slug, name
+	FROM categories
+	WHERE lower(name) LIKE $1
+	ORDER BY position, lower(name)
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pattern := likePrefix(prefix)
+	suggestions := &Suggestions{Products: []Suggestion{}, Categories: []Suggestion{}}
+
+	rows, err := p.DB.QueryContext(ctx, productQuery, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Name)
+		if err != nil {
+			return nil, err
+		}
+		suggestions.Products = append(suggestions.Products, suggestion)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = p.DB.QueryContext(ctx, categoryQuery, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.Slug, &suggestion.Name)
+		if err != nil {
+			return nil, err
+		}
+		suggestions.Categories = append(suggestions.Categories, suggestion)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// SearchResult is one product found by a unified search, along with where it
+// matched. A product can match on its own text, through its reviews, or both.
+type SearchResult struct {
+	Product       *Product     `json:"product"`
+	MatchedIn     []string     `json:"matched_in"`
+	Score         float64      `json:"score"`
+	ReviewMatches int          `json:"review_matches"`
+	Reviews       []*ReviewHit `json:"reviews,omitempty"`
+}
+
+// ReviewHit is a review that matched a search, with the matching passage.
+type ReviewHit struct {
+	ID      int64  `json:"id"`
+	Author  string `json:"author"`
+	Rating  int64  `json:"rating"`
+	Snippet string `json:"snippet"`
+}
+
+// reviewHitsPerProduct caps how many matching reviews are shown under each
+// product.
+const reviewHitsPerProduct = 3
+
+// reviewMatchWeight scales review matches relative to matches on the product
+// itself, so that a product named after the search still comes first.
+const reviewMatchWeight = 0.5
+
+// SearchModel searches products and their reviews together. Language is
+// the text search configuration searches are parsed with; UseLanguage makes
+// the stored search vectors match it.
+type SearchModel struct {
+	DB       *sql.DB
+	Language string
+}
+
+// UseLanguage makes language the text search configuration the products'
+// and reviews' search_vector columns are built with. When it differs from
+// the stored one every vector is rebuilt, which blocks product and review
+// writes until it is done. It reports whether a rebuild happened.
+func (m SearchModel) UseLanguage(language string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), searchReindexTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var changed bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT language <> $1::regconfig
+	FROM search_settings
+	FOR UPDATE
+	`, language).Scan(&changed)
+	if err != nil {
+		if raised(err, undefinedObject) {
+			return false, fmt.Errorf("%w: %s", ErrUnknownSearchLanguage, language)
+		}
+		return false, err
+	}
+	if !changed {
+		return false, tx.Commit()
+	}
+
+	statements := []string{
+		`UPDATE search_settings SET language = $1::regconfig`,
+		`UPDATE products SET search_vector = products_search_vector($1::regconfig, name, category, description)`,
+		`UPDATE reviews SET search_vector = reviews_search_vector($1::regconfig, text)`,
+	}
+	for _, statement := range statements {
+		_, err = tx.ExecContext(ctx, statement, language)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// Search finds products matching search, either directly or through their
+// reviews, and pages through them by combined relevance.
+func (m SearchModel) Search(search string, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := `
+	WITH q AS (
+		SELECT websearch_to_tsquery($2::regconfig, $1) AS query
+	), product_hits AS (
+		SELECT p.id AS product_id, ts_rank_cd(p.search_vector, q.query) AS rank
+		FROM products p, q
+		WHERE p.deleted_at IS NULL AND p.search_vector @@ q.query
+	), review_hits AS (
+		SELECT r.product_id,
+			(array_agg(r.id ORDER BY ts_rank_cd(r.search_vector, q.query) DESC, r.id))[1:$5] AS review_ids,
+			COUNT(*) AS matches,
+			MAX(ts_rank_cd(r.search_vector, q.query)) AS rank
+		FROM reviews r
+		JOIN products p ON p.id = r.product_id, q
+		WHERE r.deleted_at IS NULL AND p.deleted_at IS NULL AND r.search_vector @@ q.query
+		GROUP BY r.product_id
+	)
+	SELECT COUNT(*) OVER(),
+		COALESCE(ph.product_id, rh.product_id),
+		ph.product_id IS NOT NULL,
+		COALESCE(rh.review_ids, '{}'),
+		COALESCE(rh.matches, 0),
+		(COALESCE(ph.rank, 0) + $6 * COALESCE(rh.rank, 0))::double precision AS score
+	FROM product_hits ph
+	FULL JOIN review_hits rh ON rh.product_id = ph.product_id
+	ORDER BY score DESC, 2
+	LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, search, m.Language, filters.limit(), filters.offset(), reviewHitsPerProduct, reviewMatchWeight)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*SearchResult{}
+	productIDs := []int64{}
+	reviewIDs := []int64{}
+	resultsByProduct := make(map[int64]*SearchResult)
+
+	for rows.Next() {
+		var productID int64
+		var productMatched bool
+		var hits pq.Int64Array
+		result := &SearchResult{MatchedIn: []string{}}
+
+		err := rows.Scan(&totalRecords, &productID, &productMatched, &hits, &result.ReviewMatches, &result.Score)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if productMatched {
+			result.MatchedIn = append(result.MatchedIn, "product")
+		}
+		if result.ReviewMatches > 0 {
+			result.MatchedIn = append(result.MatchedIn, "reviews")
+		}
+
+		results = append(results, result)
+		resultsByProduct[productID] = result
+		productIDs = append(productIDs, productID)
+		reviewIDs = append(reviewIDs, hits...)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	products, err := getProductsByID(ctx, m.DB, productIDs)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	for _, product := range products {
+		resultsByProduct[product.ID].Product = product
+	}
+
+	err = attachHighlights(ctx, m.DB, products, search, m.Language)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = m.attachReviewHits(ctx, resultsByProduct, reviewIDs, search)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetaData(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
+
+// attachReviewHits loads the matching reviews shown under each result, with
+// a highlighted snippet of the passage that matched.
+func (m SearchModel) attachReviewHits(ctx context.Context, resultsByProduct map[int64]*SearchResult, ids []int64, search string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `
+	SELECT r.product_id, r.id, r.author, r.rating, ts_headline($3::regconfig, r.text, q, $4)
+	FROM reviews r, websearch_to_tsquery($3::regconfig, $2) AS q
+	WHERE r.id = ANY($1)
+	ORDER BY ts_rank_cd(r.search_vector, q) DESC, r.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids), search, m.Language, descriptionHeadlineOptions)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int64
+		var hit ReviewHit
+		err := rows.Scan(&productID, &hit.ID, &hit.Author, &hit.Rating, &hit.Snippet)
+		if err != nil {
+			return err
+		}
+		hit.Snippet = highlightHTML(hit.Snippet)
+
+		result := resultsByProduct[productID]
+		result.Reviews = append(result.Reviews, &hit)
+	}
+
+	return rows.Err()
+}
+
+// getProductsByID loads the products with the given ids, in no particular
+// order.
+func getProductsByID(ctx context.Context, db *sql.DB, ids []int64) ([]*Product, error) {
+	if len(ids) == 0 {
+		return []*Product{}, nil
+	}
+
+	query := `
+	SELECT id, name, description, category, price, currency, average_rating, image_url, seller, stock, COALESCE(external_sku, ''), created_at
+	FROM products
+	WHERE id = ANY($1)
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Category, &product.Price.Amount, &product.Price.Currency, &product.AverageRating, &product.ImageURL, &product.Seller, &product.Stock, &product.ExternalSKU, &product.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		products = append(products, &product)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = attachTags(ctx, db, products)
+	if err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
@@ -0,0 +1,159 @@
+package data
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHighlightHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		headline string
+		want     string
+	}{
+		{"plain", "red " + highlightStart + "kettle" + highlightStop, "red <mark>kettle</mark>"},
+		{"markup in the text", `<script>alert(1)</script> ` + highlightStart + "kettle" + highlightStop, `&lt;script&gt;alert(1)&lt;/script&gt; <mark>kettle</mark>`},
+		{"quotes and ampersands", `"fast" & ` + highlightStart + "cheap" + highlightStop, `&#34;fast&#34; &amp; <mark>cheap</mark>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlightHTML(tt.headline)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchHighlightsEscapeNames(t *testing.T) {
+	db := newTestDB(t)
+	insertTestProduct(t, db, "<script>alert(1)</script> Kettle")
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "relevance", SortSafeList: []string{"relevance"}}
+
+	products, _, err := ProductModel{DB: db, SearchLanguage: "english"}.GetAll(ProductFilter{Search: "kettle"}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Fatalf("got %d products; want 1", len(products))
+	}
+
+	name := products[0].Highlights["name"]
+	if strings.Contains(name, "<script>") {
+		t.Errorf("got name highlight %q; want the markup escaped", name)
+	}
+	if !strings.Contains(name, "<mark>Kettle</mark>") {
+		t.Errorf("got name highlight %q; want the match marked", name)
+	}
+}
+
+func TestSearchPastLastPageIsNotFuzzy(t *testing.T) {
+	db := newTestDB(t)
+	insertTestProduct(t, db, "Kettle")
+	insertTestProduct(t, db, "Kettlebell")
+
+	filters := Filters{Page: 5, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+	products, metadata, err := ProductModel{DB: db, SearchLanguage: "english"}.GetAll(ProductFilter{Search: "kettle"}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Fuzzy || len(products) != 0 {
+		t.Errorf("got %d products with fuzzy = %t past the last page; want none and no fuzzy fallback", len(products), metadata.Fuzzy)
+	}
+
+	filters.Page = 1
+	_, metadata, err = ProductModel{DB: db, SearchLanguage: "english"}.GetAll(ProductFilter{Search: "ketle"}, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.Fuzzy {
+		t.Error("got no fuzzy fallback for a misspelt search")
+	}
+}
+
+func TestSearchReviewSnippetsEscapeText(t *testing.T) {
+	db := newTestDB(t)
+	product := insertTestProduct(t, db, "Toaster")
+
+	review := &Review{ProductID: product.ID, Author: "ana", Rating: 1, Text: `<img src=x onerror=alert(1)> the kettle leaks`}
+	err := ReviewModel{DB: db}.Insert(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := Filters{Page: 1, PageSize: 10}
+
+	results, _, err := SearchModel{DB: db, Language: "english"}.Search("kettle", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Reviews) != 1 {
+		t.Fatalf("got %d results; want the product found through its review", len(results))
+	}
+
+	snippet := results[0].Reviews[0].Snippet
+	if strings.Contains(snippet, "<img") {
+		t.Errorf("got snippet %q; want the markup escaped", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>kettle</mark>") {
+		t.Errorf("got snippet %q; want the match marked", snippet)
+	}
+}
+
+func TestSearchUseLanguage(t *testing.T) {
+	db := newTestDB(t)
+	insertTestProduct(t, db, "Kettles")
+	search := SearchModel{DB: db, Language: "english"}
+
+	changed, err := search.UseLanguage("english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("got a rebuild for the language already in use")
+	}
+
+	results, _, err := search.Search("kettle", Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want the plural found by its stem", len(results))
+	}
+
+	// The simple configuration does no stemming, so once the vectors are
+	// rebuilt with it only the exact word matches.
+	search.Language = "simple"
+	changed, err = search.UseLanguage("simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("got no rebuild after changing the language")
+	}
+
+	results, _, err = search.Search("kettle", Filters{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("got %d results; want none without stemming", len(results))
+	}
+
+	products, _, err := ProductModel{DB: db, SearchLanguage: "simple"}.GetAll(ProductFilter{Search: "kettles"}, Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != 1 {
+		t.Errorf("got %d products; want the exact word found", len(products))
+	}
+
+	_, err = search.UseLanguage("klingon")
+	if !errors.Is(err, ErrUnknownSearchLanguage) {
+		t.Errorf("got %v; want ErrUnknownSearchLanguage", err)
+	}
+}
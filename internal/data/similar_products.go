@@ -0,0 +1,232 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SimilarProduct is a precomputed recommendation. Reasons lists the signals
+// that contributed to Score: "category", "tags", "text" and "co_reviewed".
+type SimilarProduct struct {
+	Product    *Product  `json:"product"`
+	Score      float64   `json:"score"`
+	Reasons    []string  `json:"reasons"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// Weights of the similarity signals. Each signal is scaled to 0..1 first, so
+// the scores also fall between 0 and 1.
+const (
+	similarCategoryWeight   = 0.25
+	similarTagsWeight       = 0.25
+	similarTextWeight       = 0.3
+	similarCoReviewedWeight = 0.2
+
+	// coReviewersForFullScore is how many shared reviewers count as the
+	// strongest possible co-review signal.
+	coReviewersForFullScore = 5
+
+	// similarProductsKept is how many recommendations are stored per product.
+	similarProductsKept = 20
+
+	// similarCandidatesPerSignal is how many candidates each signal offers a
+	// product: the best rated in its category, and those sharing the most
+	// tags, the most reviewers or the closest name.
+	similarCandidatesPerSignal = 25
+)
+
+type SimilarProductModel struct {
+	DB *sql.DB
+}
+
+// Recompute rebuilds every product's recommendations and reports how many
+// were stored. Each product is only scored against a bounded set of
+// candidates, at most similarCandidatesPerSignal from each signal, so the
+// work grows with the catalogue rather than with the number of pairs in it.
+// The table is replaced inside a transaction so readers keep seeing the
+// previous results until the new ones are complete. It scans the whole
+// catalogue, so it gets a longer timeout than the other batch operations.
+func (m SimilarProductModel) Recompute() (int64, error) {
+	query := `
+	WITH live AS (
+		SELECT id, category, name, tsvector_to_array(search_vector) AS lexemes
+		FROM products
+		WHERE deleted_at IS NULL
+	), candidates AS (
+		SELECT DISTINCT a.id AS product_id, k.similar_id
+		FROM live a
+		CROSS JOIN LATERAL (
+			(SELECT b.id AS similar_id
+			FROM products b
+			WHERE b.category = a.category AND b.id <> a.id AND b.deleted_at IS NULL
+			ORDER BY b.average_rating DESC, b.id
+			LIMIT $7)
+			UNION ALL
+			(SELECT y.product_id
+			FROM product_tags x
+			JOIN product_tags y ON y.tag_id = x.tag_id AND y.product_id <> x.product_id
+			JOIN products b ON b.id = y.product_id AND b.deleted_at IS NULL
+			WHERE x.product_id = a.id
+			GROUP BY y.product_id
+			ORDER BY COUNT(*) DESC, y.product_id
+			LIMIT $7)
+			UNION ALL
+			(SELECT y.product_id
+			FROM reviews x
+			JOIN reviews y ON y.author = x.author AND y.product_id <> x.product_id
+			JOIN products b ON b.id = y.product_id AND b.deleted_at IS NULL
+			WHERE x.product_id = a.id AND x.deleted_at IS NULL AND y.deleted_at IS NULL
+			GROUP BY y.product_id
+			ORDER BY COUNT(DISTINCT y.author) DESC, y.product_id
+			LIMIT $7)
+			UNION ALL
+			(SELECT b.id
+			FROM products b
+			WHERE b.name % a.name AND b.id <> a.id AND b.deleted_at IS NULL
+			ORDER BY similarity(b.name, a.name) DESC, b.id
+			LIMIT $7)
+		) k
+	), tag_counts AS (
+		SELECT product_id, COUNT(*) AS tags
+		FROM product_tags
+		GROUP BY product_id
+	), shared_tags AS (
+		SELECT c.product_id, c.similar_id, COUNT(*) AS shared
+		FROM candidates c
+		JOIN product_tags x ON x.product_id = c.product_id
+		JOIN product_tags y ON y.product_id = c.similar_id AND y.tag_id = x.tag_id
+		GROUP BY c.product_id, c.similar_id
+	), shared_reviewers AS (
+		SELECT c.product_id, c.similar_id, COUNT(DISTINCT x.author) AS shared
+		FROM candidates c
+		JOIN reviews x ON x.product_id = c.product_id AND x.deleted_at IS NULL
+		JOIN reviews y ON y.product_id = c.similar_id AND y.author = x.author AND y.deleted_at IS NULL
+		GROUP BY c.product_id, c.similar_id
+	), signals AS (
+		SELECT c.product_id, c.similar_id,
+			(a.category = b.category) AS same_category,
+			COALESCE(st.shared::double precision / NULLIF(COALESCE(ta.tags, 0) + COALESCE(tb.tags, 0) - st.shared, 0), 0) AS tags,
+			COALESCE(lx.shared::double precision / NULLIF(cardinality(a.lexemes) + cardinality(b.lexemes) - lx.shared, 0), 0) AS text_overlap,
+			LEAST(COALESCE(sr.shared, 0)::double precision / $5::double precision, 1) AS co_reviewed
+		FROM candidates c
+		JOIN live a ON a.id = c.product_id
+		JOIN live b ON b.id = c.similar_id
+		LEFT JOIN tag_counts ta ON ta.product_id = c.product_id
+		LEFT JOIN tag_counts tb ON tb.product_id = c.similar_id
+		LEFT JOIN shared_tags st ON st.product_id = c.product_id AND st.similar_id = c.similar_id
+		LEFT JOIN shared_reviewers sr ON sr.product_id = c.product_id AND sr.similar_id = c.similar_id
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS shared
+			FROM unnest(a.lexemes) AS lexeme
+			WHERE lexeme = ANY(b.lexemes)
+		) lx
+	), ranked AS (
+		SELECT product_id, similar_id,
+			$1::double precision * same_category::integer + $2::double precision * tags
+				+ $3::double precision * text_overlap + $4::double precision * co_reviewed AS score,
+			array_remove(ARRAY[
+				CASE WHEN same_category THEN 'category' END,
+				CASE WHEN tags > 0 THEN 'tags' END,
+				CASE WHEN text_overlap > 0 THEN 'text' END,
+				CASE WHEN co_reviewed > 0 THEN 'co_reviewed' END
+			], NULL) AS reasons
+		FROM signals
+	)
+	INSERT INTO product_similarities (product_id, similar_product_id, score, reasons)
+	SELECT product_id, similar_id, score, reasons
+	FROM (
+		SELECT *, row_number() OVER (PARTITION BY product_id ORDER BY score DESC, similar_id) AS rank
+		FROM ranked
+		WHERE score > 0
+	) best
+	WHERE rank <= $6
+	`
+	args := []any{similarCategoryWeight, similarTagsWeight, similarTextWeight, similarCoReviewedWeight,
+		coReviewersForFullScore, similarProductsKept, similarCandidatesPerSignal}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM product_similarities`)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	stored, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return stored, tx.Commit()
+}
+
+// GetAll returns the stored recommendations for a product, best first.
+// Products deleted since the last recompute are left out.
+func (m SimilarProductModel) GetAll(productID int64, limit int) ([]*SimilarProduct, error) {
+	query := `
+	SELECT s.similar_product_id, s.score, s.reasons, s.computed_at
+	FROM product_similarities s
+	JOIN products p ON p.id = s.similar_product_id
+	WHERE s.product_id = $1 AND p.deleted_at IS NULL
+	ORDER BY s.score DESC, s.similar_product_id
+	LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, productID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []*SimilarProduct{}
+	byID := make(map[int64]*SimilarProduct)
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		var reasons pq.StringArray
+		item := &SimilarProduct{}
+
+		err := rows.Scan(&id, &item.Score, &reasons, &item.ComputedAt)
+		if err != nil {
+			return nil, err
+		}
+		item.Reasons = reasons
+
+		similar = append(similar, item)
+		byID[id] = item
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := getProductsByID(ctx, m.DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		byID[product.ID].Product = product
+	}
+
+	return similar, nil
+}
@@ -0,0 +1,129 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSimilarProductsScoring(t *testing.T) {
+	db := newTestDB(t)
+	products := ProductModel{DB: db}
+
+	kettle := insertTestProduct(t, db, "Electric Kettle")
+	glassKettle := insertTestProduct(t, db, "Glass Electric Kettle")
+	toaster := insertTestProduct(t, db, "Toaster")
+	deleted := insertTestProduct(t, db, "Electric Kettle Classic")
+
+	for _, product := range []*Product{kettle, glassKettle} {
+		product.Tags = []string{"kitchen", "electric"}
+		err := products.Update(product)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, product := range []*Product{kettle, toaster} {
+		err := ReviewModel{DB: db}.Insert(&Review{ProductID: product.ID, Author: "ana", Rating: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := products.Delete(deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	similar := SimilarProductModel{DB: db}
+
+	_, err = similar.Recompute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := similar.GetAll(kettle.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d recommendations; want the glass kettle and the toaster, not the deleted product", len(got))
+	}
+
+	best, next := got[0], got[1]
+	if best.Product.ID != glassKettle.ID {
+		t.Errorf("got product %d first; want the glass kettle, which shares the category, tags and name", best.Product.ID)
+	}
+	if best.Score <= next.Score || best.Score > 1 || next.Score <= 0 {
+		t.Errorf("got scores %v and %v; want them in (0, 1] and the glass kettle ahead", best.Score, next.Score)
+	}
+
+	for _, reason := range []string{"category", "tags", "text"} {
+		if !slices.Contains(best.Reasons, reason) {
+			t.Errorf("got reasons %v for the glass kettle; want %q among them", best.Reasons, reason)
+		}
+	}
+	if slices.Contains(best.Reasons, "co_reviewed") {
+		t.Errorf("got reasons %v for the glass kettle; want no co-review, nobody reviewed both", best.Reasons)
+	}
+
+	if !slices.Contains(next.Reasons, "co_reviewed") || slices.Contains(next.Reasons, "tags") {
+		t.Errorf("got reasons %v for the toaster; want co_reviewed and not tags", next.Reasons)
+	}
+}
+
+func TestSimilarProductsSkipTrashedCandidates(t *testing.T) {
+	db := newTestDB(t)
+	products := ProductModel{DB: db}
+
+	err := CategoryModel{DB: db}.Insert(&Category{Name: "Other", Slug: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lamp := insertTestProduct(t, db, "Lamp")
+	lamp.Tags = []string{"brass", "vintage"}
+	err = products.Update(lamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Enough trashed products sharing both tags to fill the tag signal's
+	// candidate budget on their own.
+	for i := range similarCandidatesPerSignal {
+		trashed := insertTestProduct(t, db, fmt.Sprintf("Trashed %d", i))
+		trashed.Tags = []string{"brass", "vintage"}
+		err := products.Update(trashed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = products.Delete(trashed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vase := insertTestProduct(t, db, "Vase")
+	vase.Category = "other"
+	vase.Tags = []string{"brass"}
+	err = products.Update(vase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	similar := SimilarProductModel{DB: db}
+
+	_, err = similar.Recompute()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := similar.GetAll(lamp.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Product.ID != vase.ID {
+		t.Errorf("got %d recommendations; want only the vase, which trashed products must not crowd out", len(got))
+	}
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/awt-test1/internal/validator"
+)
+
+// NormalizeTags slugifies the tags and drops blanks and duplicates, keeping
+// the order they were given in.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		slug := Slugify(tag)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		normalized = append(normalized, slug)
+	}
+	return normalized
+}
+
+func ValidateTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= 20, "tags", "must not contain more than 20 tags")
+	for _, tag := range tags {
+		if len(tag) > 50 {
+			v.AddError("tags", "must not contain tags more than 50 bytes long")
+			return
+		}
+	}
+}
+
+// saveProductTags replaces the tags of a product, creating any tag that
+// does not exist yet.
+func saveProductTags(ctx context.Context, tx *sql.Tx, productID int64, tags []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM product_tags WHERE product_id = $1`, productID)
+	if err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	query := `
+	INSERT INTO tags (slug)
+	SELECT unnest($1::text[])
+	ON CONFLICT (slug) DO NOTHING
+	`
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO product_tags (product_id, tag_id)
+	SELECT $1::bigint, id
+	FROM tags
+	WHERE slug = ANY($2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, productID, pq.Array(tags))
+	return err
+}
+
+// attachTags loads the tags for a page of products in a single query and
+// embeds them in place.
+func attachTags(ctx context.Context, db queryer, products []*Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		product.Tags = []string{}
+		byID[product.ID] = product
+		ids = append(ids, product.ID)
+	}
+
+	query := `
+	SELECT pt.product_id, t.slug
+	FROM product_tags pt
+	JOIN tags t ON t.id = pt.tag_id
+	WHERE pt.product_id = ANY($1)
+	ORDER BY t.slug
+	`
+
+	rows, err := db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int64
+		var slug string
+		err := rows.Scan(&productID, &slug)
+		if err != nil {
+			return err
+		}
+
+		product := byID[productID]
+		product.Tags = append(product.Tags, slug)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestDB returns a connection to a new schema with every migration
+// applied, dropped again when the test ends. Tests that need a database are
+// skipped unless TEST_DB_DSN holds the URL of a PostgreSQL database they may
+// create schemas in.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema+",public")
+	u.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+
+	for _, migration := range migrations {
+		statements, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = db.Exec(string(statements))
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(migration), err)
+		}
+	}
+
+	return db
+}
+
+// insertTestProduct stores a product priced at 10.00 USD in a "test"
+// category, creating the category on first use.
+func insertTestProduct(t *testing.T, db *sql.DB, name string) *Product {
+	t.Helper()
+
+	_, err := db.Exec(`INSERT INTO categories (name, slug) VALUES ('Test', 'test') ON CONFLICT DO NOTHING`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	product := &Product{
+		Name:        name,
+		Description: "A product for tests",
+		Category:    "test",
+		Price:       Money{Amount: 1000, Currency: "USD"},
+		Seller:      "seller",
+		Stock:       10,
+	}
+
+	err = ProductModel{DB: db}.Insert(product)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return product
+}
@@ -0,0 +1,152 @@
+// Package media validates uploaded images and prepares them for storage.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("file must be a JPEG or PNG image")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+	ErrInvalidImage    = errors.New("file is not a valid image")
+)
+
+type Limits struct {
+	MaxBytes      int64
+	MaxDimension  int
+	ThumbnailSize int
+}
+
+// Image is an upload that has been sniffed, bounds-checked and re-encoded.
+// Re-encoding drops EXIF and any other metadata the original carried.
+type Image struct {
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Data        []byte
+	Thumbnail   []byte
+}
+
+// Process reads at most limits.MaxBytes from r and returns the cleaned image
+// together with a thumbnail no larger than limits.ThumbnailSize on either side.
+func Process(r io.Reader, limits Limits) (*Image, error) {
+	raw, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(raw)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return nil, ErrUnsupportedType
+	}
+
+	// Check the header before decoding so a small file that claims enormous
+	// dimensions cannot make us allocate the whole bitmap.
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return nil, fmt.Errorf("%w: maximum is %dx%d", ErrTooManyPixels, limits.MaxDimension, limits.MaxDimension)
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	img := &Image{
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+
+	img.Data, err = encode(decoded, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	img.Thumbnail, err = encode(thumbnail(decoded, limits.ThumbnailSize), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		img.Extension = ".jpg"
+	case "image/png":
+		img.Extension = ".png"
+	}
+
+	return img, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch contentType {
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// thumbnail scales img down so its longest side is size pixels, averaging
+// the source pixels that fall into each destination pixel.
+func thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, max(1, height*size/width)
+	if height > width {
+		thumbWidth, thumbHeight = max(1, width*size/height), size
+	}
+
+	thumb := image.NewRGBA64(image.Rect(0, 0, thumbWidth, thumbHeight))
+
+	for y := 0; y < thumbHeight; y++ {
+		y0 := bounds.Min.Y + y*height/thumbHeight
+		y1 := bounds.Min.Y + (y+1)*height/thumbHeight
+
+		for x := 0; x < thumbWidth; x++ {
+			x0 := bounds.Min.X + x*width/thumbWidth
+			x1 := bounds.Min.X + (x+1)*width/thumbWidth
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			thumb.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+
+	return thumb
+}
@@ -0,0 +1,137 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+var testLimits = Limits{MaxBytes: 1 << 20, MaxDimension: 1000, ThumbnailSize: 64}
+
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		want   error
+	}{
+		{"too large", encodeTestImage(t, "png", 100, 100), Limits{MaxBytes: 100, MaxDimension: 1000, ThumbnailSize: 64}, ErrTooLarge},
+		{"gif", encodeTestImage(t, "gif", 10, 10), testLimits, ErrUnsupportedType},
+		{"text", []byte("not an image at all"), testLimits, ErrUnsupportedType},
+		{"too wide", encodeTestImage(t, "png", 1001, 10), testLimits, ErrTooManyPixels},
+		{"too tall", encodeTestImage(t, "jpeg", 10, 1001), testLimits, ErrTooManyPixels},
+		{"truncated", encodeTestImage(t, "png", 100, 100)[:60], testLimits, ErrInvalidImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(bytes.NewReader(tt.data), tt.limits)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestProcessHugeHeader checks that an image whose header claims enormous
+// dimensions is refused before any pixels are decoded.
+func TestProcessHugeHeader(t *testing.T) {
+	data := encodeTestImage(t, "png", 1, 1)
+
+	// The IHDR chunk follows the 8-byte signature: a length, the type, 13
+	// bytes of data starting with width and height, then a CRC over the
+	// type and data.
+	binary.BigEndian.PutUint32(data[16:20], 1<<16)
+	binary.BigEndian.PutUint32(data[20:24], 1<<16)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	_, err := Process(bytes.NewReader(data), testLimits)
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("got %v; want ErrTooManyPixels", err)
+	}
+}
+
+func TestProcessThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		format        string
+		width, height int
+		thumbWidth    int
+		thumbHeight   int
+		contentType   string
+		extension     string
+	}{
+		{"landscape", "png", 400, 100, 64, 16, "image/png", ".png"},
+		{"portrait", "jpeg", 100, 400, 16, 64, "image/jpeg", ".jpg"},
+		{"square", "png", 200, 200, 64, 64, "image/png", ".png"},
+		{"sliver", "png", 1000, 1, 64, 1, "image/png", ".png"},
+		{"already small", "jpeg", 40, 30, 40, 30, "image/jpeg", ".jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Process(bytes.NewReader(encodeTestImage(t, tt.format, tt.width, tt.height)), testLimits)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if img.ContentType != tt.contentType || img.Extension != tt.extension {
+				t.Errorf("got %s %s; want %s %s", img.ContentType, img.Extension, tt.contentType, tt.extension)
+			}
+			if img.Width != tt.width || img.Height != tt.height {
+				t.Errorf("got %dx%d; want %dx%d", img.Width, img.Height, tt.width, tt.height)
+			}
+
+			config, format, err := image.DecodeConfig(bytes.NewReader(img.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tt.width || config.Height != tt.height || !strings.HasSuffix(tt.contentType, format) {
+				t.Errorf("got data %dx%d %s; want %dx%d %s", config.Width, config.Height, format, tt.width, tt.height, tt.contentType)
+			}
+
+			config, format, err = image.DecodeConfig(bytes.NewReader(img.Thumbnail))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tt.thumbWidth || config.Height != tt.thumbHeight || !strings.HasSuffix(tt.contentType, format) {
+				t.Errorf("got thumbnail %dx%d %s; want %dx%d %s", config.Width, config.Height, format, tt.thumbWidth, tt.thumbHeight, tt.contentType)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPathRejectsEscapes(t *testing.T) {
+	local := Local{Root: t.TempDir()}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"reviews/12/a.jpg", filepath.Join(local.Root, "reviews", "12", "a.jpg")},
+		{"../secret", ""},
+		{"reviews/../../secret", ""},
+		{"reviews/../a.jpg", ""},
+		{"/etc/passwd", ""},
+		{`reviews\..\..\secret`, ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			path, err := local.path(tt.key)
+			if tt.want == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("got %q, %v; want ErrNotFound", path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != tt.want {
+				t.Errorf("got %q; want %q", path, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	local := Local{Root: t.TempDir()}
+	ctx := context.Background()
+
+	err := local.Put(ctx, "reviews/12/a.jpg", "image/jpeg", []byte("jpeg bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := local.Get(ctx, "reviews/12/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "jpeg bytes" {
+		t.Errorf("got %q; want %q", data, "jpeg bytes")
+	}
+
+	err = local.Put(ctx, "../escaped.jpg", "image/jpeg", []byte("x"))
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v writing outside the root; want ErrNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(local.Root), "escaped.jpg")); err == nil {
+		t.Error("got a file written outside the root")
+	}
+
+	err = local.Delete(ctx, "reviews/12/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = local.Get(ctx, "reviews/12/a.jpg")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v after delete; want ErrNotFound", err)
+	}
+}
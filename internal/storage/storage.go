@@ -0,0 +1,18 @@
+// Package storage keeps uploaded files outside the database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage is a flat key/value store for binary objects. Keys are
+// slash-separated paths such as "reviews/12/abc.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
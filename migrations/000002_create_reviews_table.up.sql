@@ -1 +1,8 @@
-DROP TABLE IF EXISTS reviews;
\ No newline at end of file
+CREATE TABLE IF NOT EXISTS reviews (
+    id bigserial PRIMARY KEY,
+	product_id bigserial REFERENCES products,
+	author text NOT NULL,
+	rating integer NOT NULL,
+	helpful_count integer NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+)
\ No newline at end of file
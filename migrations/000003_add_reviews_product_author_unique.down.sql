@@ -0,0 +1,7 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_product_author_key;
+
+INSERT INTO reviews (id, product_id, author, rating, helpful_count, created_at)
+SELECT id, product_id, author, rating, helpful_count, created_at
+FROM duplicate_reviews;
+
+DROP TABLE IF EXISTS duplicate_reviews;
@@ -0,0 +1,19 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_product_author_key;
+
+-- Reviews that duplicate an earlier review by the same author are moved to
+-- duplicate_reviews rather than deleted, so that none are lost.
+CREATE TABLE IF NOT EXISTS duplicate_reviews (LIKE reviews INCLUDING DEFAULTS);
+ALTER TABLE duplicate_reviews ADD COLUMN IF NOT EXISTS archived_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+
+WITH duplicates AS (
+	DELETE FROM reviews r
+	USING reviews older
+	WHERE r.product_id = older.product_id
+		AND r.author = older.author
+		AND r.id > older.id
+	RETURNING r.*
+)
+INSERT INTO duplicate_reviews
+SELECT * FROM duplicates;
+
+ALTER TABLE reviews ADD CONSTRAINT reviews_product_author_key UNIQUE (product_id, author);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS product_review_stats (
+	product_id bigint PRIMARY KEY REFERENCES products ON DELETE CASCADE,
+	stars_1 integer NOT NULL DEFAULT 0,
+	stars_2 integer NOT NULL DEFAULT 0,
+	stars_3 integer NOT NULL DEFAULT 0,
+	stars_4 integer NOT NULL DEFAULT 0,
+	stars_5 integer NOT NULL DEFAULT 0,
+	total integer NOT NULL DEFAULT 0,
+	mean double precision NOT NULL DEFAULT 0,
+	median double precision NOT NULL DEFAULT 0,
+	bayesian_score double precision NOT NULL DEFAULT 0,
+	percent_recommended double precision NOT NULL DEFAULT 0,
+	last_30_days integer NOT NULL DEFAULT 0,
+	last_90_days integer NOT NULL DEFAULT 0,
+	last_365_days integer NOT NULL DEFAULT 0,
+	computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
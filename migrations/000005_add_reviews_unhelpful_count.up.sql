@@ -0,0 +1 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS unhelpful_count integer NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS review_responses;
+
+ALTER TABLE products DROP COLUMN IF EXISTS seller;
@@ -0,0 +1,10 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS seller text NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS review_responses (
+	id bigserial PRIMARY KEY,
+	review_id bigint NOT NULL UNIQUE REFERENCES reviews ON DELETE CASCADE,
+	seller text NOT NULL,
+	body text NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
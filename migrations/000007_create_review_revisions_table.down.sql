@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS review_revisions;
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS edited_at;
+ALTER TABLE reviews DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE reviews DROP COLUMN IF EXISTS text;
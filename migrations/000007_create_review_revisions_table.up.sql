@@ -0,0 +1,15 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS text text NOT NULL DEFAULT '';
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW();
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS edited_at timestamp(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS review_revisions (
+	id bigserial PRIMARY KEY,
+	review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+	author text NOT NULL,
+	rating integer NOT NULL,
+	text text NOT NULL,
+	editor text NOT NULL,
+	edited_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS review_revisions_review_id_idx ON review_revisions (review_id);
@@ -0,0 +1,4 @@
+ALTER TABLE product_review_stats DROP COLUMN IF EXISTS aspect_averages;
+
+DROP TABLE IF EXISTS review_aspect_ratings;
+DROP TABLE IF EXISTS rating_aspects;
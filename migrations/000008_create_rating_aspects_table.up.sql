@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS rating_aspects (
+	id bigserial PRIMARY KEY,
+	category text NOT NULL,
+	name text NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	UNIQUE (category, name)
+);
+
+CREATE TABLE IF NOT EXISTS review_aspect_ratings (
+	review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+	aspect_id bigint NOT NULL REFERENCES rating_aspects ON DELETE CASCADE,
+	rating integer NOT NULL,
+	PRIMARY KEY (review_id, aspect_id)
+);
+
+ALTER TABLE product_review_stats ADD COLUMN IF NOT EXISTS aspect_averages jsonb NOT NULL DEFAULT '{}';
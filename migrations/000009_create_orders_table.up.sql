@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS orders (
+	id bigserial PRIMARY KEY,
+	external_id text NOT NULL UNIQUE,
+	customer text NOT NULL,
+	placed_at timestamp(0) WITH TIME ZONE NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS orders_customer_idx ON orders (customer);
+
+CREATE TABLE IF NOT EXISTS order_items (
+	order_id bigint NOT NULL REFERENCES orders ON DELETE CASCADE,
+	product_id bigint NOT NULL REFERENCES products,
+	quantity integer NOT NULL,
+	PRIMARY KEY (order_id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS order_items_product_id_idx ON order_items (product_id);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS review_media (
+	id bigserial PRIMARY KEY,
+	review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+	storage_key text NOT NULL,
+	thumbnail_key text NOT NULL,
+	content_type text NOT NULL,
+	width integer NOT NULL,
+	height integer NOT NULL,
+	size_bytes bigint NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS review_media_review_id_idx ON review_media (review_id);
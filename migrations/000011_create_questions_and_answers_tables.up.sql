@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS questions (
+	id bigserial PRIMARY KEY,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	author text NOT NULL,
+	body text NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS questions_product_id_idx ON questions (product_id);
+
+CREATE TABLE IF NOT EXISTS answers (
+	id bigserial PRIMARY KEY,
+	question_id bigint NOT NULL REFERENCES questions ON DELETE CASCADE,
+	author text NOT NULL,
+	body text NOT NULL,
+	upvotes integer NOT NULL DEFAULT 0,
+	is_seller boolean NOT NULL DEFAULT false,
+	is_accepted boolean NOT NULL DEFAULT false,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	CONSTRAINT answers_question_author_key UNIQUE (question_id, author)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS answers_one_accepted_idx ON answers (question_id) WHERE is_accepted;
@@ -0,0 +1,5 @@
+ALTER TABLE rating_aspects DROP CONSTRAINT IF EXISTS rating_aspects_category_fkey;
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_category_fkey;
+
+DROP FUNCTION IF EXISTS category_slug(text);
+DROP TABLE IF EXISTS categories;
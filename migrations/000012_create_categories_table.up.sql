@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS categories (
+	id bigserial PRIMARY KEY,
+	parent_id bigint REFERENCES categories,
+	name text NOT NULL,
+	slug text NOT NULL UNIQUE,
+	position integer NOT NULL DEFAULT 0,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS categories_parent_id_idx ON categories (parent_id);
+
+CREATE OR REPLACE FUNCTION category_slug(value text) RETURNS text AS $$
+	SELECT COALESCE(NULLIF(trim(BOTH '-' FROM regexp_replace(lower(trim(value)), '[^a-z0-9]+', '-', 'g')), ''), 'uncategorized')
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- Use the most common spelling of each category as its display name.
+INSERT INTO categories (name, slug)
+SELECT DISTINCT ON (slug) category, slug
+FROM (
+	SELECT category, category_slug(category) AS slug, COUNT(*) AS uses
+	FROM (
+		SELECT category FROM products
+		UNION ALL
+		SELECT category FROM rating_aspects
+	) existing
+	GROUP BY category
+) spellings
+ORDER BY slug, uses DESC
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE products SET category = category_slug(category);
+
+DELETE FROM rating_aspects a
+USING rating_aspects b
+WHERE a.id > b.id
+	AND a.name = b.name
+	AND category_slug(a.category) = category_slug(b.category);
+
+UPDATE rating_aspects SET category = category_slug(category);
+
+ALTER TABLE products ADD CONSTRAINT products_category_fkey
+	FOREIGN KEY (category) REFERENCES categories (slug) ON UPDATE CASCADE;
+
+ALTER TABLE rating_aspects ADD CONSTRAINT rating_aspects_category_fkey
+	FOREIGN KEY (category) REFERENCES categories (slug) ON UPDATE CASCADE ON DELETE CASCADE;
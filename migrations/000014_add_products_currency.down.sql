@@ -0,0 +1,6 @@
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_price_check;
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_currency_check;
+
+UPDATE products SET price = price / 100;
+
+ALTER TABLE products DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,9 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency text NOT NULL DEFAULT 'USD';
+
+-- Prices used to be whole dollars because the fractional part was lost on
+-- insert. From now on they are stored in minor units of their currency.
+UPDATE products SET price = price * 100;
+
+ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE products ADD CONSTRAINT products_currency_check CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE products ADD CONSTRAINT products_price_check CHECK (price > 0) NOT VALID;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	from_currency text NOT NULL,
+	to_currency text NOT NULL,
+	rate numeric(20, 10) NOT NULL CHECK (rate > 0),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (from_currency, to_currency)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS price_history (
+	id bigserial PRIMARY KEY,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	price bigint NOT NULL,
+	currency text NOT NULL,
+	effective_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS price_history_product_id_effective_at_idx ON price_history (product_id, effective_at);
+
+-- Existing products have had their current price since they were created,
+-- as far as we know.
+INSERT INTO price_history (product_id, price, currency, effective_at)
+SELECT id, price, currency, created_at
+FROM products;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS product_variants (
+	id bigserial PRIMARY KEY,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	sku text NOT NULL,
+	options jsonb NOT NULL DEFAULT '{}',
+	price_override bigint CHECK (price_override > 0),
+	stock integer NOT NULL DEFAULT 0 CHECK (stock >= 0),
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	CONSTRAINT product_variants_sku_key UNIQUE (sku)
+);
+
+CREATE INDEX IF NOT EXISTS product_variants_product_id_idx ON product_variants (product_id);
+
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS variant_id bigint REFERENCES product_variants ON DELETE SET NULL;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reservations;
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_stock_check;
+ALTER TABLE products DROP COLUMN IF EXISTS stock;
@@ -0,0 +1,15 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS stock integer NOT NULL DEFAULT 0;
+ALTER TABLE products ADD CONSTRAINT products_stock_check CHECK (stock >= 0);
+
+CREATE TABLE IF NOT EXISTS reservations (
+	id bigserial PRIMARY KEY,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	variant_id bigint REFERENCES product_variants ON DELETE CASCADE,
+	quantity integer NOT NULL CHECK (quantity > 0),
+	status text NOT NULL DEFAULT 'pending',
+	expires_at timestamp(0) WITH TIME ZONE NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS reservations_pending_expires_at_idx ON reservations (expires_at) WHERE status = 'pending';
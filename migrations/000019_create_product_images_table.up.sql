@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS product_images (
+	id bigserial PRIMARY KEY,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	url text NOT NULL,
+	storage_key text NOT NULL DEFAULT '',
+	thumbnail_key text NOT NULL DEFAULT '',
+	alt_text text NOT NULL DEFAULT '',
+	position integer NOT NULL DEFAULT 0,
+	is_primary boolean NOT NULL DEFAULT false,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS product_images_product_id_position_idx ON product_images (product_id, position);
+CREATE UNIQUE INDEX IF NOT EXISTS product_images_primary_idx ON product_images (product_id) WHERE is_primary;
+
+-- products.image_url stays as a copy of the primary image's URL.
+INSERT INTO product_images (product_id, url, is_primary)
+SELECT id, image_url, true
+FROM products
+WHERE image_url <> '';
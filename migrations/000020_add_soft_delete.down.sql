@@ -0,0 +1,15 @@
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_product_id_fkey;
+ALTER TABLE reviews ADD CONSTRAINT reviews_product_id_fkey
+	FOREIGN KEY (product_id) REFERENCES products;
+
+DELETE FROM reviews WHERE deleted_at IS NOT NULL;
+DELETE FROM products WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS reviews_product_author_key;
+ALTER TABLE reviews ADD CONSTRAINT reviews_product_author_key UNIQUE (product_id, author);
+
+DROP INDEX IF EXISTS reviews_deleted_at_idx;
+DROP INDEX IF EXISTS products_deleted_at_idx;
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
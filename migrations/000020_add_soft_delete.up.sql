@@ -0,0 +1,14 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS products_deleted_at_idx ON products (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS reviews_deleted_at_idx ON reviews (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- A deleted review must not stop its author from writing a new one.
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_product_author_key;
+CREATE UNIQUE INDEX IF NOT EXISTS reviews_product_author_key ON reviews (product_id, author) WHERE deleted_at IS NULL;
+
+-- Purging a product takes its reviews with it.
+ALTER TABLE reviews DROP CONSTRAINT IF EXISTS reviews_product_id_fkey;
+ALTER TABLE reviews ADD CONSTRAINT reviews_product_id_fkey
+	FOREIGN KEY (product_id) REFERENCES products ON DELETE CASCADE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS categories_lower_name_pattern_idx;
+DROP INDEX IF EXISTS products_lower_name_pattern_idx;
+DROP INDEX IF EXISTS products_name_trgm_idx;
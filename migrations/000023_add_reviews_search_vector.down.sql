@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS reviews_search_vector_idx;
+ALTER TABLE reviews DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,4 @@
+ALTER TABLE reviews ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', coalesce(text, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS reviews_search_vector_idx ON reviews USING GIN (search_vector);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS product_similarities (
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	similar_product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	score double precision NOT NULL,
+	reasons text[] NOT NULL DEFAULT '{}',
+	computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (product_id, similar_product_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_similarities_product_id_score_idx ON product_similarities (product_id, score DESC);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS product_rankings (
+	ranking text NOT NULL,
+	product_id bigint NOT NULL REFERENCES products ON DELETE CASCADE,
+	score double precision NOT NULL,
+	review_count integer NOT NULL,
+	computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (ranking, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS product_rankings_ranking_score_idx ON product_rankings (ranking, score DESC);
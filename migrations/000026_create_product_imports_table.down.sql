@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS product_imports;
+
+ALTER TABLE products DROP COLUMN IF EXISTS external_sku;
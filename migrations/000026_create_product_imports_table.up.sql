@@ -0,0 +1,18 @@
+-- Imported products are matched on the SKU of the merchandisers' catalog.
+-- Products created through the API have none.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS external_sku text UNIQUE;
+
+CREATE TABLE IF NOT EXISTS product_imports (
+	id bigserial PRIMARY KEY,
+	status text NOT NULL DEFAULT 'running',
+	format text NOT NULL,
+	processed_rows integer NOT NULL DEFAULT 0,
+	created_rows integer NOT NULL DEFAULT 0,
+	updated_rows integer NOT NULL DEFAULT 0,
+	failed_rows integer NOT NULL DEFAULT 0,
+	row_errors jsonb NOT NULL DEFAULT '[]',
+	error text NOT NULL DEFAULT '',
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	updated_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	finished_at timestamp(0) WITH TIME ZONE
+);
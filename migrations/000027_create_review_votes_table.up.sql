@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS review_votes (
+	review_id bigint NOT NULL REFERENCES reviews ON DELETE CASCADE,
+	voter text NOT NULL,
+	helpful boolean NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (review_id, voter)
+);
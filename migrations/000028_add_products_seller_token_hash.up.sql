@@ -0,0 +1,4 @@
+-- Only the SHA-256 hash of a product's seller token is kept. Products created
+-- before this, and imported ones, have none, so no one can act as their
+-- seller.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS seller_token_hash bytea;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS answer_votes (
+	answer_id bigint NOT NULL REFERENCES answers ON DELETE CASCADE,
+	voter text NOT NULL,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (answer_id, voter)
+);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS product_images_orphaned_objects ON product_images;
+DROP TRIGGER IF EXISTS review_media_orphaned_objects ON review_media;
+DROP FUNCTION IF EXISTS queue_orphaned_objects();
+DROP TABLE IF EXISTS orphaned_objects;
@@ -0,0 +1,26 @@
+-- Storage keys of deleted review photos and product images, however the row
+-- was deleted, including by a cascade from a purged review or product. The
+-- purge job removes the objects and then their keys from here.
+CREATE TABLE IF NOT EXISTS orphaned_objects (
+	storage_key text PRIMARY KEY,
+	created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION queue_orphaned_objects() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO orphaned_objects (storage_key)
+	SELECT key
+	FROM unnest(ARRAY[OLD.storage_key, OLD.thumbnail_key]) AS key
+	WHERE key <> ''
+	ON CONFLICT DO NOTHING;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER review_media_orphaned_objects
+	AFTER DELETE ON review_media
+	FOR EACH ROW EXECUTE FUNCTION queue_orphaned_objects();
+
+CREATE TRIGGER product_images_orphaned_objects
+	AFTER DELETE ON product_images
+	FOR EACH ROW EXECUTE FUNCTION queue_orphaned_objects();
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS products_currency_change ON products;
+DROP FUNCTION IF EXISTS check_products_currency_change();
@@ -0,0 +1,19 @@
+-- Variant price overrides are stored in minor units of the product's
+-- currency, so the currency cannot change while any variant has one.
+CREATE OR REPLACE FUNCTION check_products_currency_change() RETURNS trigger AS $$
+BEGIN
+	IF NEW.currency <> OLD.currency AND EXISTS (
+		SELECT 1
+		FROM product_variants
+		WHERE product_id = NEW.id AND price_override IS NOT NULL
+	) THEN
+		RAISE EXCEPTION 'cannot change the currency of a product whose variants have price overrides'
+			USING ERRCODE = 'check_violation';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_currency_change
+	BEFORE UPDATE OF currency ON products
+	FOR EACH ROW EXECUTE FUNCTION check_products_currency_change();
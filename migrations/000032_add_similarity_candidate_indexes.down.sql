@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS reviews_author_idx;
+DROP INDEX IF EXISTS products_category_average_rating_idx;
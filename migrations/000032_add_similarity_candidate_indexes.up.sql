@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS products_category_average_rating_idx ON products (category, average_rating DESC, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS reviews_author_idx ON reviews (author) WHERE deleted_at IS NULL;
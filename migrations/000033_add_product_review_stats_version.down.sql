@@ -0,0 +1 @@
+ALTER TABLE product_review_stats DROP COLUMN IF EXISTS version;
@@ -0,0 +1 @@
+ALTER TABLE product_review_stats ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 0;
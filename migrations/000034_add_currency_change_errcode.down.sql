@@ -0,0 +1,13 @@
+CREATE OR REPLACE FUNCTION check_products_currency_change() RETURNS trigger AS $$
+BEGIN
+	IF NEW.currency <> OLD.currency AND EXISTS (
+		SELECT 1
+		FROM product_variants
+		WHERE product_id = NEW.id AND price_override IS NOT NULL
+	) THEN
+		RAISE EXCEPTION 'cannot change the currency of a product whose variants have price overrides'
+			USING ERRCODE = 'check_violation';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,15 @@
+-- Raise the currency check under its own SQLSTATE so the application can
+-- tell it apart from other check violations without matching the message.
+CREATE OR REPLACE FUNCTION check_products_currency_change() RETURNS trigger AS $$
+BEGIN
+	IF NEW.currency <> OLD.currency AND EXISTS (
+		SELECT 1
+		FROM product_variants
+		WHERE product_id = NEW.id AND price_override IS NOT NULL
+	) THEN
+		RAISE EXCEPTION 'cannot change the currency of a product whose variants have price overrides'
+			USING ERRCODE = 'PV001';
+	END IF;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,22 @@
+DROP TRIGGER IF EXISTS reviews_search_vector ON reviews;
+DROP TRIGGER IF EXISTS products_search_vector ON products;
+DROP FUNCTION IF EXISTS set_reviews_search_vector();
+DROP FUNCTION IF EXISTS set_products_search_vector();
+
+ALTER TABLE reviews DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE reviews ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (to_tsvector('english', coalesce(text, ''))) STORED;
+CREATE INDEX IF NOT EXISTS reviews_search_vector_idx ON reviews USING GIN (search_vector);
+
+ALTER TABLE products DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE products ADD COLUMN search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(category, '')), 'B') ||
+		setweight(to_tsvector('english', coalesce(description, '')), 'C')
+	) STORED;
+CREATE INDEX IF NOT EXISTS products_search_vector_idx ON products USING GIN (search_vector);
+
+DROP FUNCTION IF EXISTS reviews_search_vector(regconfig, text);
+DROP FUNCTION IF EXISTS products_search_vector(regconfig, text, text, text);
+DROP TABLE IF EXISTS search_settings;
@@ -0,0 +1,50 @@
+-- The text search configuration the search_vector columns are built with.
+-- It is set from the server's -search-language flag on start-up, which also
+-- rebuilds every vector when the language changes.
+CREATE TABLE IF NOT EXISTS search_settings (
+	id boolean PRIMARY KEY DEFAULT true CHECK (id),
+	language regconfig NOT NULL
+);
+
+INSERT INTO search_settings (language) VALUES ('english') ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION products_search_vector(language regconfig, name text, category text, description text) RETURNS tsvector AS $$
+	SELECT setweight(to_tsvector(language, coalesce(name, '')), 'A') ||
+		setweight(to_tsvector(language, coalesce(category, '')), 'B') ||
+		setweight(to_tsvector(language, coalesce(description, '')), 'C')
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION reviews_search_vector(language regconfig, text text) RETURNS tsvector AS $$
+	SELECT to_tsvector(language, coalesce(text, ''))
+$$ LANGUAGE sql IMMUTABLE;
+
+-- The vectors can no longer be generated columns, since those cannot read
+-- the language from another table. Dropping the expression keeps the
+-- existing values and the GIN indexes.
+ALTER TABLE products ALTER COLUMN search_vector DROP EXPRESSION IF EXISTS;
+ALTER TABLE reviews ALTER COLUMN search_vector DROP EXPRESSION IF EXISTS;
+
+-- The triggers share-lock the settings row so that a write cannot slip in
+-- with the old language while the vectors are being rebuilt.
+CREATE OR REPLACE FUNCTION set_products_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector := products_search_vector(
+		(SELECT language FROM search_settings FOR SHARE), NEW.name, NEW.category, NEW.description);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION set_reviews_search_vector() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector := reviews_search_vector((SELECT language FROM search_settings FOR SHARE), NEW.text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER products_search_vector
+	BEFORE INSERT OR UPDATE OF name, category, description ON products
+	FOR EACH ROW EXECUTE FUNCTION set_products_search_vector();
+
+CREATE TRIGGER reviews_search_vector
+	BEFORE INSERT OR UPDATE OF text ON reviews
+	FOR EACH ROW EXECUTE FUNCTION set_reviews_search_vector();